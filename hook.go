@@ -2,13 +2,23 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/reMarkable/k8s-hook/pkg/command"
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/output"
+	"github.com/reMarkable/k8s-hook/pkg/record"
+	"github.com/reMarkable/k8s-hook/pkg/redact"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
@@ -19,34 +29,149 @@ func main() {
 		fmt.Println("actions-k8shook version:", version)
 		os.Exit(0)
 	}
-	if os.Getenv("DEBUG_HOOK") == "1" {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	// The runner sends SIGINT, then SIGTERM, when a job is cancelled. Commands
+	// stop waiting on the cluster but still clean up what they created.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	os.Exit(run(ctx, stop))
+}
+
+func run(ctx context.Context, stop context.CancelFunc) int {
+	defer stop()
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		// Replay restores the recorded environment, so it loads its own config.
+		return replay(ctx, os.Args[2:])
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration:\n%v\n", err)
+		output.Error(os.Stdout, err)
+		return 1
+	}
+	redactor := redact.New()
+	if cfg.MaskFile != "" && (cfg.Debug || cfg.RecordDir != "") {
+		if err := redactor.AddMaskFile(cfg.MaskFile); err != nil {
+			// Without its values debug output and recordings would leak
+			// what the operator asked to hide, so do not run at all.
+			fmt.Fprintf(os.Stderr, "Failed to read mask file: %v\n", err)
+			output.Error(os.Stdout, err)
+			return 1
+		}
+	}
+	if cfg.Debug {
+		slog.SetDefault(slog.New(redactor.Handler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			return render(ctx, cfg, redactor, os.Args[2:])
+		case "doctor":
+			return command.Doctor(ctx, cfg, os.Stdout)
+		case "gc":
+			return gc(ctx, cfg, os.Args[2:])
+		}
 	}
 	var retCode int
 	if checkPipedInput() {
-		hookInput := getInput()
-		switch hookInput.Command {
-		case "prepare_job":
-			retCode = command.PrepareJob(hookInput)
-		case "cleanup_job":
-			retCode = command.CleanupJob(hookInput)
-		case "run_container_step":
-			retCode = command.RunContainerStep(hookInput)
-		case "run_script_step":
-			retCode = command.RunScriptStep(hookInput)
-		default:
-			slog.Error("Unknown command", "command", hookInput.Command)
-			os.Exit(1)
+		hookInput, inputJSON := getInput(cfg, redactor, os.Stdin)
+		var recorder *record.Recorder
+		var opts []k8s.ClientOption
+		if cfg.RecordDir != "" {
+			if recorder = startRecording(cfg, redactor, hookInput.Command, inputJSON); recorder != nil {
+				opts = recorder.ClientOptions()
+			}
+		}
+		retCode = command.Run(ctx, cfg, hookInput, opts...)
+		if recorder != nil {
+			if err := recorder.Finish(hookInput.ResponseFile, retCode); err != nil {
+				slog.Warn("Failed to finish recording", "err", err)
+			}
 		}
 	} else {
 		fmt.Println("No piped input detected. This hook is intended to be run by github actions runner.")
 	}
-	os.Exit(retCode)
+	if ctx.Err() != nil {
+		slog.Warn("Hook was cancelled by the runner")
+	}
+	return retCode
 }
 
-func getInput() types.ContainerHookInput {
+// render prints the pod manifest for the hook input in the file given as the
+// only argument, or read from stdin if no file is given.
+func render(ctx context.Context, cfg *config.Config, redactor *redact.Redactor, args []string) int {
+	in := os.Stdin
+	if len(args) > 0 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "opening hook input:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	hookInput, _ := getInput(cfg, redactor, in)
+	return command.Render(ctx, cfg, hookInput, os.Stdout)
+}
+
+// gc deletes orphaned pods and secrets in the configured namespace.
+func gc(ctx context.Context, cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	var opts k8s.GCOptions
+	flags.DurationVar(&opts.TTL, "ttl", 0, "also delete objects older than this, even if their runner pod exists")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only report what would be deleted")
+	jsonReport := flags.Bool("json", false, "write the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return command.GC(ctx, cfg, opts, *jsonReport, os.Stdout)
+}
+
+// startRecording creates a recording for this invocation, masked by redactor.
+// Recording is best effort and never fails the hook.
+func startRecording(cfg *config.Config, redactor *redact.Redactor, command string, inputJSON []byte) *record.Recorder {
+	recorder, err := record.New(cfg.RecordDir, command, redactor)
+	if err != nil {
+		slog.Warn("Failed to start recording", "err", err)
+		return nil
+	}
+	if err := recorder.SaveInvocation(inputJSON, cfg); err != nil {
+		slog.Warn("Failed to record invocation", "err", err)
+	}
+	slog.Info("Recording hook invocation", "dir", recorder.Dir())
+	return recorder
+}
+
+// replay re-runs the recording in the directory given as the only argument.
+func replay(ctx context.Context, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: actions-k8shook replay <recording-dir>")
+		return 2
+	}
+	rec, err := record.Load(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loading recording:", err)
+		return 1
+	}
+	if rec.Config.Debug {
+		redactor := redact.New()
+		redactor.AddInput(rec.Input)
+		slog.SetDefault(slog.New(redactor.Handler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	}
+	if err := command.Replay(ctx, rec); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("Replay of %s matches recording (exit code %d)\n", rec.Meta.Command, rec.Meta.ExitCode)
+	return 0
+}
+
+// getInput reads the hook input. With debug enabled it prints the input with
+// its credentials masked by redactor, which masks them from then on.
+func getInput(cfg *config.Config, redactor *redact.Redactor, in io.Reader) (types.ContainerHookInput, []byte) {
 	hookInput := types.ContainerHookInput{}
-	scanner := bufio.NewScanner(os.Stdin)
+	scanner := bufio.NewScanner(in)
 
 	var inputJSON []byte
 	for scanner.Scan() {
@@ -58,19 +183,25 @@ func getInput() types.ContainerHookInput {
 		os.Exit(1)
 	}
 	decoder := json.NewDecoder(strings.NewReader(string(inputJSON)))
-	if os.Getenv("DEBUG_HOOK") == "1" {
-		fmt.Fprintf(os.Stderr, "struct %s\n", inputJSON)
+	if cfg.Debug {
 		decoder.DisallowUnknownFields()
 	}
-	if err := decoder.Decode(&hookInput); err != nil {
-		fmt.Fprintf(os.Stderr, "Unexpected JSON structure: %v\n", err)
+	err := decoder.Decode(&hookInput)
+	// Even a partly decoded input names credentials to mask.
+	redactor.AddInput(hookInput)
+	if cfg.Debug {
+		fmt.Fprintf(os.Stderr, "struct %s\n", redactor.JSON(inputJSON))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unexpected JSON structure: %v\n", redactor.String(err.Error()))
 		os.Exit(1)
 	}
 	res, _ := json.Marshal(hookInput)
-	if os.Getenv("DEBUG_HOOK") == "1" {
-		fmt.Printf("%s\n", res)
+	if cfg.Debug {
+		// Stdout carries the runner's output and the manifest of render.
+		fmt.Fprintf(os.Stderr, "%s\n", redactor.JSON(res))
 	}
-	return hookInput
+	return hookInput, inputJSON
 }
 
 func checkPipedInput() bool {
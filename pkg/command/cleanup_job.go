@@ -1,26 +1,38 @@
 package command
 
 import (
-	"log/slog"
+	"context"
+	"errors"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
 	"github.com/reMarkable/k8s-hook/pkg/k8s"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
-func CleanupJob(input types.ContainerHookInput) int {
-	k8s, err := k8s.NewK8sClient()
-	if err != nil {
-		slog.Error("Failed to talk to kubernetes", "err", err)
-	}
-	err = k8s.PruneSecrets()
+// CleanupJob removes the job pod and secrets. It keeps going when ctx is
+// cancelled, since the runner tears the job down on cancellation too.
+func CleanupJob(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, opts ...k8s.ClientOption) int {
+	ctx, cancel := k8s.CleanupContext(ctx)
+	defer cancel()
+
+	k, err := k8s.NewK8sClient(cfg, opts...)
 	if err != nil {
-		slog.Error("Failed to prune secrets", "err", err)
+		reportError("Failed to talk to kubernetes", err)
 		return 1
 	}
 
-	err = k8s.DeletePod(input.State["jobPod"])
-	if err != nil {
-		slog.Error("Failed to clean up pod", "err", err)
+	// Remove as much as possible and report everything that is left.
+	var errs []error
+	if err := k.PruneSecrets(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if jobPod := input.State["jobPod"]; jobPod != "" {
+		if err := k.DeletePod(ctx, jobPod); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		reportError("Failed to clean up job resources", err)
 		return 1
 	}
 
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+// Doctor runs preflight checks against the cluster and prints one line per
+// check to out. It returns non-zero if any check fails; missing optional
+// permissions are only reported as warnings.
+func Doctor(ctx context.Context, cfg *config.Config, out io.Writer) int {
+	k, err := k8s.NewK8sClient(cfg)
+	if err != nil {
+		slog.Error("Failed to talk to kubernetes", "err", err)
+		return 1
+	}
+
+	return runDoctor(ctx, k, out)
+}
+
+func runDoctor(ctx context.Context, k *k8s.K8sClient, out io.Writer) int {
+	failed := 0
+	report := func(name string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(out, "OK   %s\n", name)
+	}
+
+	report("namespace "+k.GetNS(), nil)
+	_, err := k.GetPodNodeName(ctx, k.GetRunnerPodName())
+	report("runner pod "+k.GetRunnerPodName(), err)
+	report("volume claim "+k.GetVolumeClaimName(), k.CheckVolumeClaim(ctx))
+
+	for _, p := range k8s.RequiredPermissions {
+		allowed, err := k.ReviewPermission(ctx, p)
+		if err == nil && !allowed {
+			err = k8s.ErrMissingPermissions
+		}
+		report("permission "+p.String(), err)
+	}
+	for _, p := range k.OptionalPermissions() {
+		allowed, err := k.ReviewPermission(ctx, p.Permission)
+		if err == nil && !allowed {
+			fmt.Fprintf(out, "WARN permission %s: %s\n", p, p.Without)
+			continue
+		}
+		report("permission "+p.String(), err)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d check(s) failed\n", failed)
+		return 1
+	}
+
+	return 0
+}
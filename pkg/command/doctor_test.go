@@ -0,0 +1,101 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	authv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+func TestRunDoctorReportsFailures(t *testing.T) {
+	t.Parallel()
+
+	// The offline client has no runner pod, no claim and grants no permissions.
+	var out bytes.Buffer
+	if got := runDoctor(t.Context(), k8s.NewOfflineClient(config.Default()), &out); got != 1 {
+		t.Errorf("runDoctor() = %d, want 1", got)
+	}
+
+	report := out.String()
+	for _, want := range []string{"OK   namespace", "FAIL runner pod", "FAIL volume claim", "FAIL permission create pods/exec"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("runDoctor() output missing %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestRunDoctorWarnsAboutOptionalPermissions(t *testing.T) {
+	t.Parallel()
+	watch := "WARN permission watch pods: falls back to polling\n"
+	tests := map[string]struct {
+		transport string
+		want      []string
+	}{
+		"auto": {
+			transport: config.ExecTransportAuto,
+			want:      []string{watch, "WARN permission get pods/exec: exec falls back to SPDY on clusters older than 1.35\n"},
+		},
+		"websocket": {
+			transport: config.ExecTransportWebSocket,
+			want:      []string{watch, "WARN permission get pods/exec: exec fails on clusters older than 1.35\n"},
+		},
+		"spdy": {
+			transport: config.ExecTransportSPDY,
+			want:      []string{watch},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.Default()
+			cfg.Namespace = "default"
+			cfg.RunnerPodName = "runner"
+			cfg.ExecTransport = tt.transport
+			clientset := fake.NewClientset(
+				&v1.Pod{ObjectMeta: v1Meta.ObjectMeta{Name: "runner", Namespace: "default"}},
+				&v1.PersistentVolumeClaim{ObjectMeta: v1Meta.ObjectMeta{Name: cfg.VolumeClaimName(), Namespace: "default"}},
+			)
+			// Everything but watching pods and getting pods/exec is allowed.
+			clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+				createAction, ok := action.(k8sTesting.CreateAction)
+				if !ok {
+					return false, nil, nil
+				}
+				review, ok := createAction.GetObject().(*authv1.SelfSubjectAccessReview)
+				if !ok {
+					return false, nil, nil
+				}
+				attrs := review.Spec.ResourceAttributes
+				review.Status.Allowed = attrs.Verb != "watch" && (attrs.Verb != "get" || attrs.Subresource != "exec")
+				return true, review, nil
+			})
+			k, err := k8s.NewK8sClient(cfg, k8s.WithClientset(clientset))
+			if err != nil {
+				t.Fatalf("NewK8sClient() unexpected error = %v", err)
+			}
+
+			var out bytes.Buffer
+			if got := runDoctor(t.Context(), k, &out); got != 0 {
+				t.Errorf("runDoctor() = %d, want 0:\n%s", got, out.String())
+			}
+			if got := strings.Count(out.String(), "WARN"); got != len(tt.want) {
+				t.Errorf("runDoctor() printed %d warnings, want %d:\n%s", got, len(tt.want), out.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("runDoctor() output missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
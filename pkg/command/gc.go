@@ -0,0 +1,64 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+// GC deletes the pods and secrets of runners that no longer exist, or that
+// are older than the TTL, and writes a report to out. It is meant to run
+// periodically, e.g. from a CronJob, next to the runners.
+func GC(ctx context.Context, cfg *config.Config, opts k8s.GCOptions, jsonReport bool, out io.Writer) int {
+	k, err := k8s.NewK8sClient(cfg)
+	if err != nil {
+		slog.Error("Failed to talk to kubernetes", "err", err)
+		return 1
+	}
+
+	return runGC(ctx, k, opts, jsonReport, out)
+}
+
+func runGC(ctx context.Context, k *k8s.K8sClient, opts k8s.GCOptions, jsonReport bool, out io.Writer) int {
+	report, err := k.CollectGarbage(ctx, opts)
+	if err != nil {
+		slog.Error("Failed to collect garbage", "err", err)
+		return 1
+	}
+
+	if jsonReport {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			slog.Error("Failed to write report", "err", err)
+			return 1
+		}
+	} else {
+		writeGCReport(out, report)
+	}
+
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func writeGCReport(out io.Writer, report *k8s.GCReport) {
+	action := "deleted"
+	if report.DryRun {
+		action = "would delete"
+	}
+	for _, item := range report.Items {
+		if item.Error != "" {
+			fmt.Fprintf(out, "FAIL %s/%s: %s\n", item.Kind, item.Name, item.Error)
+			continue
+		}
+		fmt.Fprintf(out, "%s %s/%s of runner %s: %s\n", action, item.Kind, item.Name, item.RunnerPod, item.Reason)
+	}
+	fmt.Fprintf(out, "%d orphaned object(s) in namespace %s\n", len(report.Items), report.Namespace)
+}
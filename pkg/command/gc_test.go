@@ -0,0 +1,66 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+func TestRunGC(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		json bool
+		want string
+	}{
+		"text": {
+			want: "would delete pod/gone-workflow of runner gone: runner pod is gone\n1 orphaned object(s) in namespace default\n",
+		},
+		"json": {
+			json: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config.Default()
+			cfg.Namespace = "default"
+			clientset := fake.NewClientset(&v1.Pod{ObjectMeta: v1Meta.ObjectMeta{
+				Name:      "gone-workflow",
+				Namespace: "default",
+				Labels:    map[string]string{"runner-pod": "gone"},
+			}})
+			k, err := k8s.NewK8sClient(cfg, k8s.WithClientset(clientset))
+			if err != nil {
+				t.Fatalf("NewK8sClient() unexpected error = %v", err)
+			}
+
+			var out bytes.Buffer
+			if got := runGC(t.Context(), k, k8s.GCOptions{DryRun: true}, tt.json, &out); got != 0 {
+				t.Errorf("runGC() = %d, want 0", got)
+			}
+
+			if !tt.json {
+				if out.String() != tt.want {
+					t.Errorf("runGC() output = %q, want %q", out.String(), tt.want)
+				}
+				return
+			}
+			var report k8s.GCReport
+			if err := json.NewDecoder(strings.NewReader(out.String())).Decode(&report); err != nil {
+				t.Fatalf("runGC() output is not JSON: %v\n%s", err, out.String())
+			}
+			if !report.DryRun || len(report.Items) != 1 || report.Items[0].Name != "gone-workflow" || report.Items[0].Deleted {
+				t.Errorf("runGC() report = %+v, want gone-workflow not deleted", report)
+			}
+		})
+	}
+}
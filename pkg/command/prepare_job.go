@@ -2,12 +2,17 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"time"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/container"
 	"github.com/reMarkable/k8s-hook/pkg/k8s"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 	"github.com/reMarkable/k8s-hook/pkg/validation"
@@ -15,30 +20,41 @@ import (
 
 const contextKeyContainer = "container"
 
-func PrepareJob(input types.ContainerHookInput) int {
+func PrepareJob(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, opts ...k8s.ClientOption) int {
 	if err := validation.ValidateServices(input.Args.Services); err != nil {
-		slog.Error("Invalid service configuration", "err", err)
+		reportError("Invalid service configuration", err)
 		return 1
 	}
 
-	k, err := k8s.NewK8sClient()
+	if cfg.InspectImage {
+		inspectServiceHealthchecks(ctx, input.Args.Services)
+	}
+
+	k, err := k8s.NewK8sClient(cfg, opts...)
 	if err != nil {
-		slog.Error("Failed to talk to kubernetes", "err", err)
+		reportError("Failed to talk to kubernetes", err)
 		return 1
 	}
 
-	podName, err := k.CreatePod(input.Args, k8s.PodTypeJob)
+	podName, err := k.CreatePod(ctx, input.Args, k8s.PodTypeJob)
+	if errors.Is(err, k8s.ErrPodExists) {
+		podName, err = replaceStaleJobPod(ctx, cfg, k, input.Args)
+	}
 	if err != nil {
 		// FIXME: We need more robust error handling here
-		slog.Error("Failed to create pod", "err", err)
+		reportError("Failed to create pod", err)
 		return 1
 	}
 	alpineArgs := []string{"-c", "test -f /etc/alpine-release"}
-	isAlpine := k.ExecInPod(podName, alpineArgs)
+	isAlpine := k.ExecInPod(ctx, podName, alpineArgs)
+	if errors.Is(isAlpine, k8s.ErrMissingShell) {
+		reportError("Job image has no shell", isAlpine)
+		return 1
+	}
 
 	slog.Info("Created pod", "pod", podName)
 
-	services, err := k.ExtractServiceInfo(podName)
+	services, err := k.ExtractServiceInfo(ctx, podName)
 	if err != nil {
 		slog.Warn("Failed to extract service info", "err", err)
 	}
@@ -64,6 +80,46 @@ func PrepareJob(input types.ContainerHookInput) int {
 	return 0
 }
 
+// replaceStaleJobPod handles a job pod left behind by an earlier job, which
+// happens when the runner crashed before cleanup_job. Depending on the
+// configuration the pod is adopted if it matches the job, or deleted and
+// created again.
+func replaceStaleJobPod(ctx context.Context, cfg *config.Config, k *k8s.K8sClient, args types.InputArgs) (string, error) {
+	if cfg.StaleJobPod == config.StaleJobPodAdopt {
+		podName, ok, err := k.AdoptJobPod(ctx, args)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			slog.Info("Adopted existing job pod", "pod", podName)
+			return podName, nil
+		}
+	}
+
+	if err := k.ReclaimJobPod(ctx); err != nil {
+		return "", err
+	}
+	return k.CreatePod(ctx, args, k8s.PodTypeJob)
+}
+
+// inspectServiceHealthchecks reads the HEALTHCHECK of each service image, so
+// the job waits for services whose images define one. Failures only mean the
+// job does not wait for that service.
+func inspectServiceHealthchecks(ctx context.Context, services []types.ServiceDefinition) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	inspector := container.NewInspector(ctx)
+	for i := range services {
+		healthcheck, err := inspector.GetHealthcheck(services[i].Image, services[i].Registry)
+		if err != nil {
+			slog.Warn("Failed to inspect service image for health check", "service", services[i].ContextName, "image", services[i].Image, "err", err)
+			continue
+		}
+		services[i].Healthcheck = healthcheck
+	}
+}
+
 func writeResponse(file string, response types.ResponseType) error {
 	body, err := json.MarshalIndent(response, "", "  ")
 	slog.Debug("Writing response", "body", string(body))
@@ -0,0 +1,59 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+	"github.com/reMarkable/k8s-hook/pkg/validation"
+)
+
+var ErrRenderCommand = errors.New("cannot render command")
+
+// Render writes the pod manifest the given hook input would create to out,
+// without talking to the API server.
+func Render(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, out io.Writer) int {
+	if err := renderPod(ctx, cfg, input, out); err != nil {
+		slog.Error("Failed to render pod", "err", err)
+		return 1
+	}
+
+	return 0
+}
+
+func renderPod(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, out io.Writer) error {
+	args := input.Args
+	var podType k8s.PodType
+	switch input.Command {
+	case "prepare_job":
+		if err := validation.ValidateServices(args.Services); err != nil {
+			return err
+		}
+		podType = k8s.PodTypeJob
+	case "run_container_step":
+		args.Container = args.ContainerDefinition
+		podType = k8s.PodTypeContainerStep
+	default:
+		return fmt.Errorf("%w: %q does not create a pod", ErrRenderCommand, input.Command)
+	}
+
+	pod, err := k8s.NewOfflineClient(cfg).RenderPod(ctx, args, podType)
+	if err != nil {
+		return err
+	}
+
+	body, err := yaml.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(body)
+	return err
+}
@@ -0,0 +1,86 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestRenderPod(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		file               string
+		command            string
+		wantContainerNames []string
+		wantErr            error
+	}{
+		"job with services": {
+			file:               "../../examples/prepare-job-with-services.json",
+			wantContainerNames: []string{"job", "redis", "postgres", "nginx"},
+		},
+		"job without services": {
+			file:               "../../examples/prepare_job.json",
+			wantContainerNames: []string{"job"},
+		},
+		"container step": {
+			file:               "../../examples/run-container-step.json",
+			wantContainerNames: []string{"job"},
+		},
+		"script step has no pod": {
+			file:    "../../examples/run-script-step.json",
+			wantErr: ErrRenderCommand,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatalf("Failed to read example input: %v", err)
+			}
+			var input types.ContainerHookInput
+			if err := json.Unmarshal(data, &input); err != nil {
+				t.Fatalf("Failed to parse example input: %v", err)
+			}
+
+			var out bytes.Buffer
+			err = renderPod(t.Context(), config.Default(), input, &out)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("renderPod() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderPod() unexpected error = %v", err)
+			}
+
+			var pod v1.Pod
+			if err := yaml.Unmarshal(out.Bytes(), &pod); err != nil {
+				t.Fatalf("Rendered output is not a pod manifest: %v\n%s", err, out.String())
+			}
+			if pod.Kind != "Pod" || pod.APIVersion != "v1" {
+				t.Errorf("renderPod() type = %s/%s, want v1/Pod", pod.APIVersion, pod.Kind)
+			}
+			if len(pod.Spec.Containers) != len(tt.wantContainerNames) {
+				t.Fatalf("renderPod() container count = %d, want %d", len(pod.Spec.Containers), len(tt.wantContainerNames))
+			}
+			for i, want := range tt.wantContainerNames {
+				if pod.Spec.Containers[i].Name != want {
+					t.Errorf("renderPod() container[%d].Name = %s, want %s", i, pod.Spec.Containers[i].Name, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+
+	"github.com/reMarkable/k8s-hook/pkg/record"
+)
+
+var ErrReplayMismatch = errors.New("replay does not match recording")
+
+// Replay re-runs a recorded invocation against its recorded API responses and
+// reports whether the exit code and response file match the recording.
+func Replay(ctx context.Context, rec *record.Recording) error {
+	tmp, err := os.MkdirTemp("", "hook-replay-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// The recorded environment is only for the replay, not for the caller.
+	defer restoreEnv(append(slices.Collect(maps.Keys(rec.Env)), "RUNNER_TEMP", "RUNNER_WORKSPACE"))()
+	for name, value := range rec.Env {
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	// Keep the replay away from the runner's directories.
+	if err := os.Setenv("RUNNER_TEMP", tmp); err != nil {
+		return err
+	}
+	if err := os.Unsetenv("RUNNER_WORKSPACE"); err != nil {
+		return err
+	}
+
+	cfg := *rec.Config
+	cfg.RecordDir = ""
+	input := rec.Input
+	if input.ResponseFile != "" {
+		input.ResponseFile = filepath.Join(tmp, "response.json")
+	}
+
+	exitCode := Run(ctx, &cfg, input, rec.ClientOptions()...)
+
+	var errs []error
+	if exitCode != rec.Meta.ExitCode {
+		errs = append(errs, fmt.Errorf("%w: exit code %d, recorded %d", ErrReplayMismatch, exitCode, rec.Meta.ExitCode))
+	}
+	if input.ResponseFile != "" {
+		response, err := os.ReadFile(input.ResponseFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !sameJSON(response, rec.Response) {
+			errs = append(errs, fmt.Errorf("%w: response\n%s\nrecorded\n%s", ErrReplayMismatch, response, rec.Response))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreEnv returns a function that sets the environment variables names back
+// to their current values, unsetting those that are not set now.
+func restoreEnv(names []string) func() {
+	type saved struct {
+		value string
+		set   bool
+	}
+	env := make(map[string]saved, len(names))
+	for _, name := range names {
+		value, set := os.LookupEnv(name)
+		env[name] = saved{value: value, set: set}
+	}
+
+	return func() {
+		for name, saved := range env {
+			if saved.set {
+				_ = os.Setenv(name, saved.value)
+			} else {
+				_ = os.Unsetenv(name)
+			}
+		}
+	}
+}
+
+// sameJSON reports whether two JSON documents are equal, ignoring formatting.
+// Two empty documents are equal.
+func sameJSON(a, b []byte) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+
+	var av, bv any
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
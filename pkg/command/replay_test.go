@@ -0,0 +1,69 @@
+package command
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/record"
+)
+
+const recordingsDir = "testdata/recordings"
+
+//nolint:paralleltest // replay sets the recorded process environment while it runs
+func TestReplayRecordings(t *testing.T) {
+	entries, err := os.ReadDir(recordingsDir)
+	if err != nil {
+		t.Fatalf("Failed to list recordings: %v", err)
+	}
+	for _, entry := range entries {
+		t.Run(entry.Name(), func(t *testing.T) {
+			rec, err := record.Load(filepath.Join(recordingsDir, entry.Name()))
+			if err != nil {
+				t.Fatalf("Failed to load recording: %v", err)
+			}
+			if err := Replay(t.Context(), rec); err != nil {
+				t.Errorf("Replay() error = %v", err)
+			}
+		})
+	}
+}
+
+//nolint:paralleltest // replay sets the recorded process environment while it runs
+func TestReplayMismatch(t *testing.T) {
+	rec, err := record.Load(filepath.Join(recordingsDir, "cleanup-job"))
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	rec.Meta.ExitCode = 1
+	if err := Replay(t.Context(), rec); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("Replay() error = %v, want %v", err, ErrReplayMismatch)
+	}
+}
+
+//nolint:paralleltest // replay sets the recorded process environment while it runs
+func TestReplayRestoresEnv(t *testing.T) {
+	rec, err := record.Load(filepath.Join(recordingsDir, "cleanup-job"))
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	t.Setenv("RUNNER_WORKSPACE", "/runner/_work")
+	t.Setenv("RUNNER_TEMP", "/runner/_work/_temp")
+	for name := range rec.Env {
+		t.Setenv(name, "before replay")
+	}
+	if err := Replay(t.Context(), rec); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	want := map[string]string{"RUNNER_WORKSPACE": "/runner/_work", "RUNNER_TEMP": "/runner/_work/_temp"}
+	for name := range rec.Env {
+		want[name] = "before replay"
+	}
+	for name, value := range want {
+		if got := os.Getenv(name); got != value {
+			t.Errorf("%s after Replay() = %q, want %q", name, got, value)
+		}
+	}
+}
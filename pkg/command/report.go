@@ -0,0 +1,35 @@
+package command
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+
+	"k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/output"
+)
+
+// reportError logs err and writes it as an error annotation to the job log.
+func reportError(msg string, err error) {
+	slog.Error(msg, "err", err)
+	output.Error(os.Stdout, err)
+}
+
+// stepExitCode returns the exit code for the runner after running a step. A
+// step that ran and failed passes its own exit code through, since workflows
+// may depend on it, and is not reported as a hook failure. Anything else is a
+// failure of the hook or the cluster and exits 1.
+func stepExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		slog.Info("Step exited with non-zero exit code", "code", exitErr.ExitStatus(), "err", err)
+		return exitErr.ExitStatus()
+	}
+	reportError("Failed to run step in pod", err)
+	return 1
+}
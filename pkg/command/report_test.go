@@ -0,0 +1,45 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+func TestStepExitCode(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"success": {
+			err:  nil,
+			want: 0,
+		},
+		"step failed": {
+			err:  exec.CodeExitError{Err: errors.New("command terminated with exit code 3"), Code: 3},
+			want: 3,
+		},
+		"wrapped step failure": {
+			err:  fmt.Errorf("step: %w", exec.CodeExitError{Err: errors.New("command terminated with exit code 137"), Code: 137}),
+			want: 137,
+		},
+		"stream broke": {
+			err:  fmt.Errorf("%w job: %w", k8s.ErrExec, errors.New("connection reset by peer")),
+			want: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := stepExitCode(tt.err); got != tt.want {
+				t.Errorf("stepExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
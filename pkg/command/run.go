@@ -0,0 +1,28 @@
+package command
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+// Run dispatches the hook input to the command it names and returns the exit
+// code for the runner.
+func Run(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, opts ...k8s.ClientOption) int {
+	switch input.Command {
+	case "prepare_job":
+		return PrepareJob(ctx, cfg, input, opts...)
+	case "cleanup_job":
+		return CleanupJob(ctx, cfg, input, opts...)
+	case "run_container_step":
+		return RunContainerStep(ctx, cfg, input, opts...)
+	case "run_script_step":
+		return RunScriptStep(ctx, cfg, input, opts...)
+	default:
+		slog.Error("Unknown command", "command", input.Command)
+		return 1
+	}
+}
@@ -2,83 +2,86 @@ package command
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
 	"time"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
 	"github.com/reMarkable/k8s-hook/pkg/container"
 	"github.com/reMarkable/k8s-hook/pkg/k8s"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
-func RunContainerStep(input types.ContainerHookInput) int {
+var ErrMissingEntrypoint = errors.New("self hosted container steps require an entrypoint: set one in the action, or configure containerStepEntrypoint or inspectImage for the runner")
+
+func RunContainerStep(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, opts ...k8s.ClientOption) int {
 	if input.Args.Entrypoint == "" {
-		if !trySetEntrypointFromImage(&input) {
+		if !trySetEntrypointFromImage(ctx, cfg, &input) {
 			return 1
 		}
 	}
 
 	if input.Args.Dockerfile != "" {
-		slog.Error("Self hosted container steps do not support Docker builder at this time")
+		reportError("Unsupported container step", fmt.Errorf("%w: self hosted container steps do not support Docker builder at this time", k8s.ErrNotSupported))
 		return 1
 	}
 
-	k, err := k8s.NewK8sClient()
+	k, err := k8s.NewK8sClient(cfg, opts...)
 	if err != nil {
-		slog.Error("Failed to talk to kubernetes", "err", err)
+		reportError("Failed to talk to kubernetes", err)
 		return 1
 	}
 
 	args := input.Args
 	args.Container = args.ContainerDefinition
-	podName, err := k.CreatePod(args, k8s.PodTypeContainerStep)
+	podName, err := k.CreatePod(ctx, args, k8s.PodTypeContainerStep)
 	if err != nil {
-		slog.Error("Failed to create pod", "err", err)
+		reportError("Failed to create pod", err)
 		return 1
 	}
 
 	defer func() {
-		err = k.DeletePod(podName)
+		// The step pod must go even if the job was cancelled.
+		cleanupCtx, cancel := k8s.CleanupContext(ctx)
+		defer cancel()
+		err = k.DeleteStepPod(cleanupCtx, podName)
 		if err != nil {
 			slog.Error("Failed to clean up pod", "err", err)
 		}
 	}()
-	err = k.ExecStepInPod(podName, input.Args)
-	if err != nil {
-		slog.Error("Failed to run container", "err", err)
-		return 1
+	if cfg.ContainerStepMode == config.ContainerStepModeDirect {
+		return stepExitCode(k.FollowStepPod(ctx, podName))
 	}
-
-	return 0
+	return stepExitCode(k.ExecStepInPod(ctx, podName, input.Args))
 }
 
 // trySetEntrypointFromImage attempts to set the entrypoint from image inspection
-// or environment variables. Returns false if entrypoint cannot be determined.
-func trySetEntrypointFromImage(input *types.ContainerHookInput) bool {
-	// EXPERIMENTAL: Try to inspect the image to get entrypoint if ENV_HOOK_INSPECT_IMAGE is set
-	if os.Getenv("ENV_HOOK_INSPECT_IMAGE") == "1" {
-		if inspectAndSetEntrypoint(input) {
+// or the configured default. Returns false if entrypoint cannot be determined.
+func trySetEntrypointFromImage(ctx context.Context, cfg *config.Config, input *types.ContainerHookInput) bool {
+	// EXPERIMENTAL: Try to inspect the image to get entrypoint if inspectImage is enabled
+	if cfg.InspectImage {
+		if inspectAndSetEntrypoint(ctx, input) {
 			return true
 		}
 	}
 
-	entrypointEnv := os.Getenv("ENV_HOOK_CONTAINER_STEP_ENTRYPOINT")
-	if entrypointEnv != "" {
-		slog.Info("Entrypoint not set, using ENV_HOOK_CONTAINER_STEP_ENTRYPOINT from environment", "entrypoint", entrypointEnv) // #nosec G706 -- value is operator-supplied env var; anyone who can set it already has full access
-		input.Args.Entrypoint = entrypointEnv
+	if cfg.ContainerStepEntrypoint != "" {
+		slog.Info("Entrypoint not set, using configured containerStepEntrypoint", "entrypoint", cfg.ContainerStepEntrypoint) // #nosec G706 -- value is operator-supplied config; anyone who can set it already has full access
+		input.Args.Entrypoint = cfg.ContainerStepEntrypoint
 		return true
 	}
 
-	slog.Error("Self hosted container steps requires entrypoint to be set")
+	reportError("Unsupported container step", ErrMissingEntrypoint)
 	return false
 }
 
 // inspectAndSetEntrypoint inspects the container image and sets the entrypoint if found.
 // Returns true if entrypoint was successfully set.
-func inspectAndSetEntrypoint(input *types.ContainerHookInput) bool {
-	slog.Info("ENV_HOOK_INSPECT_IMAGE is enabled, attempting to inspect image for entrypoint", "image", input.Args.Image)
+func inspectAndSetEntrypoint(ctx context.Context, input *types.ContainerHookInput) bool {
+	slog.Info("inspectImage is enabled, attempting to inspect image for entrypoint", "image", input.Args.Image)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	inspector := container.NewInspector(ctx)
@@ -86,14 +89,14 @@ func inspectAndSetEntrypoint(input *types.ContainerHookInput) bool {
 
 	switch {
 	case err != nil:
-		slog.Warn("Failed to inspect image for entrypoint, will fall back to environment variable", "err", err, "image", input.Args.Image)
+		slog.Warn("Failed to inspect image for entrypoint, will fall back to containerStepEntrypoint", "err", err, "image", input.Args.Image)
 		return false
 	case entrypoint != "":
 		slog.Info("Using entrypoint from image config", "entrypoint", entrypoint, "image", input.Args.Image)
 		input.Args.Entrypoint = entrypoint
 		return true
 	default:
-		slog.Debug("Image has no entrypoint defined, will fall back to environment variable", "image", input.Args.Image)
+		slog.Debug("Image has no entrypoint defined, will fall back to containerStepEntrypoint", "image", input.Args.Image)
 		return false
 	}
 }
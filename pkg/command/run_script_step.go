@@ -1,24 +1,19 @@
 package command
 
 import (
-	"log/slog"
+	"context"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
 	"github.com/reMarkable/k8s-hook/pkg/k8s"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
-func RunScriptStep(input types.ContainerHookInput) int {
-	k8s, err := k8s.NewK8sClient()
+func RunScriptStep(ctx context.Context, cfg *config.Config, input types.ContainerHookInput, opts ...k8s.ClientOption) int {
+	k8s, err := k8s.NewK8sClient(cfg, opts...)
 	if err != nil {
-		slog.Error("Failed to talk to kubernetes", "err", err)
+		reportError("Failed to talk to kubernetes", err)
 		return 1
 	}
 
-	err = k8s.ExecStepInPod(input.State["jobPod"], input.Args)
-	if err != nil {
-		slog.Error("Failed to execute step in pod", "err", err)
-		return 1
-	}
-
-	return 0
+	return stepExitCode(k8s.ExecStepInPod(ctx, input.State["jobPod"], input.Args))
 }
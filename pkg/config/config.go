@@ -0,0 +1,319 @@
+// Package config loads and validates the hook configuration.
+//
+// Settings are resolved in order of increasing precedence: built-in defaults,
+// the YAML file named by ENV_HOOK_CONFIG_PATH, and finally the individual
+// environment variables listed in envOverrides.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+const (
+	// EnvConfigPath names the environment variable pointing to the config file.
+	EnvConfigPath = "ENV_HOOK_CONFIG_PATH"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// What prepare_job does with a job pod left behind by an earlier job.
+const (
+	// StaleJobPodReclaim deletes the stale pod and creates a new one.
+	StaleJobPodReclaim = "reclaim"
+	// StaleJobPodAdopt reuses the stale pod if it runs the same images and
+	// is ready, and reclaims it otherwise.
+	StaleJobPodAdopt = "adopt"
+)
+
+// How container steps run in their pod.
+const (
+	// ContainerStepModeExec keeps the step container alive and runs the
+	// entrypoint in it through sh.
+	ContainerStepModeExec = "exec"
+	// ContainerStepModeDirect runs the entrypoint as the container's main
+	// process, for images without a shell.
+	ContainerStepModeDirect = "direct"
+)
+
+// How the run script of a step reaches the container.
+const (
+	// StepScriptModeStdin pipes the script to sh over the exec stream.
+	StepScriptModeStdin = "stdin"
+	// StepScriptModeFile writes the script to the runner's temp directory
+	// on the work volume and runs it from there.
+	StepScriptModeFile = "file"
+)
+
+// How the hook streams exec sessions to the API server.
+const (
+	// ExecTransportAuto uses WebSocket and falls back to SPDY if the
+	// connection cannot be upgraded.
+	ExecTransportAuto = "auto"
+	// ExecTransportWebSocket only uses WebSocket.
+	ExecTransportWebSocket = "websocket"
+	// ExecTransportSPDY only uses the deprecated SPDY protocol.
+	ExecTransportSPDY = "spdy"
+)
+
+// Config holds every setting that controls the hook's behaviour.
+type Config struct {
+	// Debug enables debug logging and input dumps.
+	Debug bool `json:"debug"`
+	// Namespace is where job pods and secrets are created. Defaults to the
+	// service account namespace, or "default" outside a cluster.
+	Namespace string `json:"namespace"`
+	// RunnerPodName is the name of the pod running the actions runner.
+	RunnerPodName string `json:"runnerPodName"`
+	// ClaimName is the work volume claim. Defaults to "<runnerPodName>-work".
+	ClaimName string `json:"claimName"`
+	// UseKubeScheduler ties job pods to the runner node through affinity
+	// instead of setting nodeName directly.
+	UseKubeScheduler bool `json:"useKubeScheduler"`
+	// DisableImagePull leaves the image pull policy unset instead of IfNotPresent.
+	DisableImagePull bool `json:"disableImagePull"`
+	// TemplatePath is a pod extension applied to every pod the hook creates.
+	TemplatePath string `json:"templatePath"`
+	// InspectImage reads the container step entrypoint from the image config.
+	InspectImage bool `json:"inspectImage"`
+	// ContainerStepEntrypoint is used when a container step has no entrypoint.
+	ContainerStepEntrypoint string `json:"containerStepEntrypoint"`
+	// PrepareJobTimeoutSeconds bounds how long to wait for pods to start.
+	PrepareJobTimeoutSeconds int `json:"prepareJobTimeoutSeconds"`
+	// RecordDir enables recording of every invocation into a subdirectory.
+	RecordDir string `json:"recordDir"`
+	// StaleJobPod is StaleJobPodReclaim or StaleJobPodAdopt.
+	StaleJobPod string `json:"staleJobPod"`
+	// DisableOwnerReferences stops the hook from making the runner pod the
+	// owner of the pods and secrets it creates, for runners that are not pods.
+	DisableOwnerReferences bool `json:"disableOwnerReferences"`
+	// DeleteGracePeriodSeconds is given to pods to shut down when they are
+	// deleted. Negative values use the pod's own grace period, or delete pods
+	// kept alive by tail immediately; zero deletes pods immediately.
+	DeleteGracePeriodSeconds int `json:"deleteGracePeriodSeconds"`
+	// DeleteTimeoutSeconds bounds how long to wait for a deleted pod to go
+	// away before it is force deleted.
+	DeleteTimeoutSeconds int `json:"deleteTimeoutSeconds"`
+	// ExecTransport is ExecTransportAuto, ExecTransportWebSocket or
+	// ExecTransportSPDY.
+	ExecTransport string `json:"execTransport"`
+	// ContainerStepMode is ContainerStepModeExec or ContainerStepModeDirect.
+	ContainerStepMode string `json:"containerStepMode"`
+	// ShellHelperImage is an image with a static busybox at /bin/busybox. If
+	// set, it provides the shell and keepalive of job containers whose images
+	// have neither.
+	ShellHelperImage string `json:"shellHelperImage"`
+	// StepScriptMode is StepScriptModeStdin or StepScriptModeFile.
+	StepScriptMode string `json:"stepScriptMode"`
+	// MaskFile lists values, one per line, that debug output and recordings must
+	// not show in addition to the credentials found in the hook input.
+	MaskFile string `json:"maskFile"`
+}
+
+// envOverrides maps environment variables onto the field they override.
+var envOverrides = []struct {
+	name  string
+	field func(c *Config) any
+}{
+	{"DEBUG_HOOK", func(c *Config) any { return &c.Debug }},
+	{"ACTIONS_RUNNER_KUBERNETES_NAMESPACE", func(c *Config) any { return &c.Namespace }},
+	{"ACTIONS_RUNNER_POD_NAME", func(c *Config) any { return &c.RunnerPodName }},
+	{"ACTIONS_RUNNER_CLAIM_NAME", func(c *Config) any { return &c.ClaimName }},
+	{"ENV_USE_KUBE_SCHEDULER", func(c *Config) any { return &c.UseKubeScheduler }},
+	{"ENV_DISABLE_IMAGE_PULL", func(c *Config) any { return &c.DisableImagePull }},
+	{"ENV_HOOK_TEMPLATE_PATH", func(c *Config) any { return &c.TemplatePath }},
+	{"ENV_HOOK_INSPECT_IMAGE", func(c *Config) any { return &c.InspectImage }},
+	{"ENV_HOOK_CONTAINER_STEP_ENTRYPOINT", func(c *Config) any { return &c.ContainerStepEntrypoint }},
+	{"ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS", func(c *Config) any { return &c.PrepareJobTimeoutSeconds }},
+	{"ENV_HOOK_RECORD_DIR", func(c *Config) any { return &c.RecordDir }},
+	{"ENV_HOOK_STALE_JOB_POD", func(c *Config) any { return &c.StaleJobPod }},
+	{"ENV_HOOK_DISABLE_OWNER_REFERENCES", func(c *Config) any { return &c.DisableOwnerReferences }},
+	{"ENV_HOOK_DELETE_GRACE_PERIOD_SECONDS", func(c *Config) any { return &c.DeleteGracePeriodSeconds }},
+	{"ENV_HOOK_DELETE_TIMEOUT_SECONDS", func(c *Config) any { return &c.DeleteTimeoutSeconds }},
+	{"ENV_HOOK_EXEC_TRANSPORT", func(c *Config) any { return &c.ExecTransport }},
+	{"ENV_HOOK_CONTAINER_STEP_MODE", func(c *Config) any { return &c.ContainerStepMode }},
+	{"ENV_HOOK_SHELL_HELPER_IMAGE", func(c *Config) any { return &c.ShellHelperImage }},
+	{"ENV_HOOK_STEP_SCRIPT_MODE", func(c *Config) any { return &c.StepScriptMode }},
+	{"ENV_HOOK_MASK_FILE", func(c *Config) any { return &c.MaskFile }},
+}
+
+// EnvNames returns the names of all environment variables that affect the
+// configuration.
+func EnvNames() []string {
+	names := []string{EnvConfigPath}
+	for _, o := range envOverrides {
+		names = append(names, o.name)
+	}
+
+	return names
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		RunnerPodName:            "local-pod",
+		PrepareJobTimeoutSeconds: 600,
+		StaleJobPod:              StaleJobPodReclaim,
+		DeleteGracePeriodSeconds: -1,
+		DeleteTimeoutSeconds:     60,
+		ExecTransport:            ExecTransportAuto,
+		ContainerStepMode:        ContainerStepModeExec,
+		StepScriptMode:           StepScriptModeStdin,
+	}
+}
+
+// Load builds the configuration from defaults, the optional config file and
+// the environment, and validates the result.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv(EnvConfigPath); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = serviceAccountNamespace()
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// VolumeClaimName returns the configured claim name or the runner default.
+func (c *Config) VolumeClaimName() string {
+	if c.ClaimName == "" {
+		return c.RunnerPodName + "-work"
+	}
+
+	return c.ClaimName
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s: %s", ErrInvalidConfig, field, fmt.Sprintf(format, args...)))
+	}
+
+	for _, msg := range validation.IsDNS1123Label(c.Namespace) {
+		invalid("namespace", "%q: %s", c.Namespace, msg)
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(c.RunnerPodName) {
+		invalid("runnerPodName", "%q: %s", c.RunnerPodName, msg)
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(c.VolumeClaimName()) {
+		invalid("claimName", "%q: %s", c.VolumeClaimName(), msg)
+	}
+	if c.PrepareJobTimeoutSeconds <= 0 {
+		invalid("prepareJobTimeoutSeconds", "must be positive, got %d", c.PrepareJobTimeoutSeconds)
+	}
+	if c.DeleteTimeoutSeconds <= 0 {
+		invalid("deleteTimeoutSeconds", "must be positive, got %d", c.DeleteTimeoutSeconds)
+	}
+	if c.StaleJobPod != StaleJobPodReclaim && c.StaleJobPod != StaleJobPodAdopt {
+		invalid("staleJobPod", "must be %q or %q, got %q", StaleJobPodReclaim, StaleJobPodAdopt, c.StaleJobPod)
+	}
+	switch c.ExecTransport {
+	case ExecTransportAuto, ExecTransportWebSocket, ExecTransportSPDY:
+	default:
+		invalid("execTransport", "must be %q, %q or %q, got %q", ExecTransportAuto, ExecTransportWebSocket, ExecTransportSPDY, c.ExecTransport)
+	}
+	if c.ContainerStepMode != ContainerStepModeExec && c.ContainerStepMode != ContainerStepModeDirect {
+		invalid("containerStepMode", "must be %q or %q, got %q", ContainerStepModeExec, ContainerStepModeDirect, c.ContainerStepMode)
+	}
+	if c.StepScriptMode != StepScriptModeStdin && c.StepScriptMode != StepScriptModeFile {
+		invalid("stepScriptMode", "must be %q or %q, got %q", StepScriptModeStdin, StepScriptModeFile, c.StepScriptMode)
+	}
+	if c.TemplatePath != "" {
+		if _, err := os.Stat(c.TemplatePath); err != nil {
+			invalid("templatePath", "%v", err)
+		}
+	}
+	if c.MaskFile != "" {
+		if _, err := os.Stat(c.MaskFile); err != nil {
+			invalid("maskFile", "%v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator-supplied ENV_HOOK_CONFIG_PATH
+	if err != nil {
+		return fmt.Errorf("%w: reading %s: %w", ErrInvalidConfig, path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("%w: parsing %s: %w", ErrInvalidConfig, path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, o := range envOverrides {
+		value, ok := lookup(o.name)
+		if !ok {
+			continue
+		}
+		if err := setField(o.field(c), value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s=%q: %w", ErrInvalidConfig, o.name, value, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func setField(field any, value string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *bool:
+		if value == "" {
+			*f = false
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*f = b
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*f = i
+	default:
+		panic(fmt.Sprintf("unsupported config field type %T", field))
+	}
+
+	return nil
+}
+
+func serviceAccountNamespace() string {
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		slog.Warn("Failed to read namespace from config or service account, defaulting to 'default'", "error", err)
+		return "default"
+	}
+
+	return strings.TrimSpace(string(namespace))
+}
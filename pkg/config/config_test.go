@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	t.Parallel()
+	path := writeConfigFile(t, `
+namespace: from-file
+runnerPodName: runner-from-file
+useKubeScheduler: true
+prepareJobTimeoutSeconds: 120
+`)
+	env := map[string]string{
+		"ACTIONS_RUNNER_POD_NAME":                    "runner-from-env",
+		"ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS": "30",
+		"ENV_HOOK_INSPECT_IMAGE":                     "1",
+	}
+
+	cfg := Default()
+	if err := cfg.loadFile(path); err != nil {
+		t.Fatalf("loadFile() unexpected error = %v", err)
+	}
+	if err := cfg.applyEnv(func(k string) (string, bool) { v, ok := env[k]; return v, ok }); err != nil {
+		t.Fatalf("applyEnv() unexpected error = %v", err)
+	}
+
+	if cfg.Namespace != "from-file" {
+		t.Errorf("Namespace = %q, want value from file", cfg.Namespace)
+	}
+	if cfg.RunnerPodName != "runner-from-env" {
+		t.Errorf("RunnerPodName = %q, want env to override file", cfg.RunnerPodName)
+	}
+	if cfg.PrepareJobTimeoutSeconds != 30 {
+		t.Errorf("PrepareJobTimeoutSeconds = %d, want env to override file", cfg.PrepareJobTimeoutSeconds)
+	}
+	if !cfg.UseKubeScheduler || !cfg.InspectImage {
+		t.Errorf("boolean settings not applied: %+v", cfg)
+	}
+	if cfg.VolumeClaimName() != "runner-from-env-work" {
+		t.Errorf("VolumeClaimName() = %q, want default derived from runner pod", cfg.VolumeClaimName())
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error = %v", err)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		file string
+		env  map[string]string
+	}{
+		"unknown key":        {file: "namespcae: typo\n"},
+		"wrong type in file": {file: "prepareJobTimeoutSeconds: soon\n"},
+		"non-numeric timeout": {
+			env: map[string]string{"ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS": "ten"},
+		},
+		"non-boolean flag": {
+			env: map[string]string{"ENV_USE_KUBE_SCHEDULER": "yes please"},
+		},
+		"zero timeout": {
+			env: map[string]string{"ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS": "0"},
+		},
+		"invalid namespace": {
+			env: map[string]string{"ACTIONS_RUNNER_KUBERNETES_NAMESPACE": "Not_A_Namespace"},
+		},
+		"zero delete timeout": {
+			env: map[string]string{"ENV_HOOK_DELETE_TIMEOUT_SECONDS": "0"},
+		},
+		"unknown stale job pod mode": {
+			env: map[string]string{"ENV_HOOK_STALE_JOB_POD": "ignore"},
+		},
+		"unknown exec transport": {
+			env: map[string]string{"ENV_HOOK_EXEC_TRANSPORT": "http2"},
+		},
+		"unknown container step mode": {
+			env: map[string]string{"ENV_HOOK_CONTAINER_STEP_MODE": "shell"},
+		},
+		"unknown step script mode": {
+			env: map[string]string{"ENV_HOOK_STEP_SCRIPT_MODE": "secret"},
+		},
+		"missing template": {
+			env: map[string]string{"ENV_HOOK_TEMPLATE_PATH": "/does/not/exist.yaml"},
+		},
+		"missing mask file": {
+			env: map[string]string{"ENV_HOOK_MASK_FILE": "/does/not/exist"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cfg := Default()
+			cfg.Namespace = "default"
+			err := func() error {
+				if tt.file != "" {
+					if err := cfg.loadFile(writeConfigFile(t, tt.file)); err != nil {
+						return err
+					}
+				}
+				if err := cfg.applyEnv(func(k string) (string, bool) { v, ok := tt.env[k]; return v, ok }); err != nil {
+					return err
+				}
+				return cfg.Validate()
+			}()
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package container
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -15,6 +16,8 @@ import (
 	"go.podman.io/image/v5/image"
 	"go.podman.io/image/v5/transports/alltransports"
 	"go.podman.io/image/v5/types"
+
+	hookTypes "github.com/reMarkable/k8s-hook/pkg/types"
 )
 
 // Inspector provides methods to inspect container images.
@@ -46,6 +49,51 @@ func NewInspector(ctx context.Context) *Inspector {
 //   - The entrypoint as a space-joined string, or empty string if the image has no entrypoint
 //   - An error if the image cannot be inspected
 func (i *Inspector) GetEntrypoint(imageRef string, registry map[string]string) (string, error) {
+	var entrypoint string
+	err := i.withImage(imageRef, registry, func(img types.Image) error {
+		config, err := img.OCIConfig(i.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get image config: %w", err)
+		}
+		entrypoint = extractEntrypoint(config)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if entrypoint == "" {
+		slog.Debug("Image has no entrypoint defined", "image", imageRef)
+	} else {
+		slog.Debug("Found entrypoint in image config", "image", imageRef, "entrypoint", entrypoint)
+	}
+
+	return entrypoint, nil
+}
+
+// GetHealthcheck retrieves the HEALTHCHECK from a container image's configuration.
+// It returns nil if the image has no health check. The registry parameter is
+// the same as for GetEntrypoint.
+func (i *Inspector) GetHealthcheck(imageRef string, registry map[string]string) (*hookTypes.Healthcheck, error) {
+	var healthcheck *hookTypes.Healthcheck
+	err := i.withImage(imageRef, registry, func(img types.Image) error {
+		blob, err := img.ConfigBlob(i.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get image config: %w", err)
+		}
+		healthcheck, err = extractHealthcheck(blob)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Inspected image for health check", "image", imageRef, "healthcheck", healthcheck)
+	return healthcheck, nil
+}
+
+// withImage opens imageRef in its registry and calls fn with it.
+func (i *Inspector) withImage(imageRef string, registry map[string]string, fn func(img types.Image) error) error {
 	// Ensure the image reference has a transport prefix
 	if !strings.Contains(imageRef, "://") {
 		imageRef = "docker://" + imageRef
@@ -62,11 +110,11 @@ func (i *Inspector) GetEntrypoint(imageRef string, registry map[string]string) (
 			imageRef = imageWithoutSHA + "@" + parts[1]
 		}
 	}
-	slog.Debug("Inspecting image for entrypoint", "image", imageRef)
+	slog.Debug("Inspecting image", "image", imageRef)
 
 	ref, err := alltransports.ParseImageName(imageRef)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse image reference: %w", err)
+		return fmt.Errorf("failed to parse image reference: %w", err)
 	}
 
 	sys := &types.SystemContext{
@@ -90,7 +138,7 @@ func (i *Inspector) GetEntrypoint(imageRef string, registry map[string]string) (
 
 	src, err := ref.NewImageSource(i.ctx, sys)
 	if err != nil {
-		return "", fmt.Errorf("failed to create image source: %w", err)
+		return fmt.Errorf("failed to create image source: %w", err)
 	}
 	defer func() {
 		if closeErr := src.Close(); closeErr != nil {
@@ -102,23 +150,10 @@ func (i *Inspector) GetEntrypoint(imageRef string, registry map[string]string) (
 
 	img, err := image.FromUnparsedImage(i.ctx, sys, unparsedInstance)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse image: %w", err)
-	}
-
-	config, err := img.OCIConfig(i.ctx)
-	if err != nil {
-		return "", fmt.Errorf("failed to get image config: %w", err)
-	}
-
-	entrypoint := extractEntrypoint(config)
-
-	if entrypoint == "" {
-		slog.Debug("Image has no entrypoint defined", "image", imageRef)
-	} else {
-		slog.Debug("Found entrypoint in image config", "image", imageRef, "entrypoint", entrypoint)
+		return fmt.Errorf("failed to parse image: %w", err)
 	}
 
-	return entrypoint, nil
+	return fn(img)
 }
 
 // extractEntrypoint extracts and formats the entrypoint from an OCI image config.
@@ -129,3 +164,23 @@ func extractEntrypoint(config *v1.Image) string {
 
 	return strings.Join(config.Config.Entrypoint, " ")
 }
+
+// extractHealthcheck extracts the health check from a raw image config. The
+// OCI config has no health check, but docker and buildah store it in the
+// same place.
+func extractHealthcheck(blob []byte) (*hookTypes.Healthcheck, error) {
+	var config struct {
+		Config struct {
+			Healthcheck *hookTypes.Healthcheck `json:"Healthcheck"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse image config: %w", err)
+	}
+
+	hc := config.Config.Healthcheck
+	if hc == nil || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return nil, nil //nolint:nilnil // an image without a health check is not an error
+	}
+	return hc, nil
+}
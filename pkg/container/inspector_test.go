@@ -4,11 +4,14 @@ package container
 
 import (
 	"context"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	hookTypes "github.com/reMarkable/k8s-hook/pkg/types"
 )
 
 func TestGetEntrypoint_Nginx(t *testing.T) {
@@ -199,3 +202,45 @@ func TestExtractEntrypoint(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractHealthcheck(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		blob     string
+		expected *hookTypes.Healthcheck
+		wantErr  bool
+	}{
+		"no healthcheck": {
+			blob: `{"config":{"Entrypoint":["/bin/sh"]}}`,
+		},
+		"disabled healthcheck": {
+			blob: `{"config":{"Healthcheck":{"Test":["NONE"]}}}`,
+		},
+		"docker healthcheck": {
+			blob: `{"config":{"Healthcheck":{"Test":["CMD-SHELL","pg_isready"],"Interval":5000000000,"Retries":10}}}`,
+			expected: &hookTypes.Healthcheck{
+				Test:     []string{"CMD-SHELL", "pg_isready"},
+				Interval: 5 * time.Second,
+				Retries:  10,
+			},
+		},
+		"invalid config": {
+			blob:    `not json`,
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := extractHealthcheck([]byte(tt.blob))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractHealthcheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	units "github.com/docker/go-units"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var (
+	ErrUnsupportedOption = errors.New("unsupported container option")
+	ErrInvalidOption     = errors.New("invalid container option")
+)
+
+// createOptions is the subset of `docker create` flags that can be expressed
+// in a pod spec.
+type createOptions struct {
+	limits      v1.ResourceList
+	runAsUser   *int64
+	runAsGroup  *int64
+	privileged  bool
+	capAdd      []v1.Capability
+	capDrop     []v1.Capability
+	env         []v1.EnvVar
+	workdir     string
+	entrypoint  string
+	shmSize     *resource.Quantity
+	tmpfs       []tmpfsMount
+	hostname    string
+	hostAliases []v1.HostAlias
+	// networkAliases are extra names the container is reachable by.
+	networkAliases []string
+	// health overrides the image health check; zero fields are not set.
+	health        types.Healthcheck
+	noHealthcheck bool
+}
+
+type tmpfsMount struct {
+	path string
+	size *resource.Quantity
+}
+
+// optionFlag describes a supported flag. Boolean flags take no value.
+type optionFlag struct {
+	boolean bool
+	parse   func(o *createOptions, value string) error
+}
+
+var optionFlags = map[string]optionFlag{
+	"--cpus":       {parse: parseCPUs},
+	"--memory":     {parse: parseMemory},
+	"-m":           {parse: parseMemory},
+	"--user":       {parse: parseUser},
+	"-u":           {parse: parseUser},
+	"--privileged": {boolean: true, parse: parsePrivileged},
+	"--cap-add":    {parse: func(o *createOptions, v string) error { o.capAdd = append(o.capAdd, capability(v)); return nil }},
+	"--cap-drop":   {parse: func(o *createOptions, v string) error { o.capDrop = append(o.capDrop, capability(v)); return nil }},
+	"--env":        {parse: parseEnv},
+	"-e":           {parse: parseEnv},
+	"--workdir":    {parse: func(o *createOptions, v string) error { o.workdir = v; return nil }},
+	"-w":           {parse: func(o *createOptions, v string) error { o.workdir = v; return nil }},
+	"--entrypoint": {parse: func(o *createOptions, v string) error { o.entrypoint = v; return nil }},
+	"--shm-size":   {parse: parseShmSize},
+	"--ulimit":     {parse: parseUlimit},
+	"--tmpfs":      {parse: parseTmpfs},
+	"--hostname":   {parse: parseHostname},
+	"-h":           {parse: parseHostname},
+	"--add-host":   {parse: parseAddHost},
+
+	"--network-alias": {parse: parseNetworkAlias},
+	"--net-alias":     {parse: parseNetworkAlias},
+
+	"--health-cmd": {parse: func(o *createOptions, v string) error {
+		o.health.Test = []string{"CMD-SHELL", v}
+		return nil
+	}},
+	"--health-interval":     {parse: durationFlag(func(o *createOptions) *time.Duration { return &o.health.Interval })},
+	"--health-timeout":      {parse: durationFlag(func(o *createOptions) *time.Duration { return &o.health.Timeout })},
+	"--health-start-period": {parse: durationFlag(func(o *createOptions) *time.Duration { return &o.health.StartPeriod })},
+	"--health-retries":      {parse: parseHealthRetries},
+	"--no-healthcheck":      {boolean: true, parse: func(o *createOptions, _ string) error { o.noHealthcheck = true; return nil }},
+}
+
+// parseCreateOptions parses docker create flags, as given in `options:` for
+// job and service containers.
+func parseCreateOptions(options string) (*createOptions, error) {
+	args, err := splitArgs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &createOptions{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		flag, ok := optionFlags[name]
+		if !ok && len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			// Short flags may have their value attached, as in -eFOO=bar.
+			name, value, hasValue = arg[:2], arg[2:], true
+			flag, ok = optionFlags[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedOption, arg)
+		}
+
+		if !hasValue && !flag.boolean {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%w: %s requires a value", ErrInvalidOption, name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := flag.parse(o, value); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", name, value, err)
+		}
+	}
+
+	return o, nil
+}
+
+// apply sets the options on container and, for pod-wide settings, on pod.
+func (o *createOptions) apply(pod *v1.Pod, container *v1.Container) {
+	if len(o.limits) > 0 {
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = v1.ResourceList{}
+		}
+		for name, quantity := range o.limits {
+			container.Resources.Limits[name] = quantity
+		}
+	}
+
+	if o.runAsUser != nil || o.runAsGroup != nil || o.privileged || len(o.capAdd) > 0 || len(o.capDrop) > 0 {
+		if container.SecurityContext == nil {
+			container.SecurityContext = &v1.SecurityContext{}
+		}
+		sc := container.SecurityContext
+		if o.runAsUser != nil {
+			sc.RunAsUser = o.runAsUser
+		}
+		if o.runAsGroup != nil {
+			sc.RunAsGroup = o.runAsGroup
+		}
+		if o.privileged {
+			sc.Privileged = new(true)
+		}
+		if len(o.capAdd) > 0 || len(o.capDrop) > 0 {
+			if sc.Capabilities == nil {
+				sc.Capabilities = &v1.Capabilities{}
+			}
+			sc.Capabilities.Add = append(sc.Capabilities.Add, o.capAdd...)
+			sc.Capabilities.Drop = append(sc.Capabilities.Drop, o.capDrop...)
+		}
+	}
+
+	container.Env = append(container.Env, o.env...)
+	if o.workdir != "" {
+		container.WorkingDir = o.workdir
+	}
+	if o.entrypoint != "" {
+		container.Command = []string{o.entrypoint}
+	}
+
+	if o.shmSize != nil {
+		addMemoryVolume(pod, container, "/dev/shm", o.shmSize)
+	}
+	for _, t := range o.tmpfs {
+		addMemoryVolume(pod, container, t.path, t.size)
+	}
+
+	if o.hostname != "" {
+		pod.Spec.Hostname = o.hostname
+	}
+	pod.Spec.HostAliases = append(pod.Spec.HostAliases, o.hostAliases...)
+}
+
+// healthcheck merges the health options over image, the health check from the
+// image config, which may be nil. It returns nil if there is no health check.
+func (o *createOptions) healthcheck(image *types.Healthcheck) *types.Healthcheck {
+	if o.noHealthcheck {
+		return nil
+	}
+
+	var hc types.Healthcheck
+	if image != nil {
+		hc = *image
+	}
+	if o.health.Test != nil {
+		hc.Test = o.health.Test
+	}
+	if o.health.Interval != 0 {
+		hc.Interval = o.health.Interval
+	}
+	if o.health.Timeout != 0 {
+		hc.Timeout = o.health.Timeout
+	}
+	if o.health.StartPeriod != 0 {
+		hc.StartPeriod = o.health.StartPeriod
+	}
+	if o.health.Retries != 0 {
+		hc.Retries = o.health.Retries
+	}
+	if len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return nil
+	}
+
+	return &hc
+}
+
+// checkJobContainer rejects options that would break the job container, which
+// the hook runs with its own keepalive command.
+func (o *createOptions) checkJobContainer() error {
+	if o.entrypoint != "" {
+		return fmt.Errorf("%w: --entrypoint cannot be used for the job container, which runs the hook's keepalive command", ErrUnsupportedOption)
+	}
+
+	return nil
+}
+
+// checkServiceContainer rejects options that are pod-wide in Kubernetes and
+// would affect the job and every other service.
+func (o *createOptions) checkServiceContainer() error {
+	if o.hostname != "" {
+		return fmt.Errorf("%w: --hostname cannot be used for a service, which shares the job pod's hostname", ErrUnsupportedOption)
+	}
+
+	return nil
+}
+
+// addMemoryVolume mounts a memory-backed emptyDir, the Kubernetes equivalent
+// of a tmpfs, at path.
+func addMemoryVolume(pod *v1.Pod, container *v1.Container, path string, size *resource.Quantity) {
+	name := newVolumeName(pod.Spec.Volumes, tmpfsVolumePrefix)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: name,
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{
+			Medium:    v1.StorageMediumMemory,
+			SizeLimit: size,
+		}},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{Name: name, MountPath: path})
+}
+
+func parseCPUs(o *createOptions, value string) error {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	o.setLimit(v1.ResourceCPU, quantity)
+	return nil
+}
+
+func parseMemory(o *createOptions, value string) error {
+	quantity, err := parseBytes(value)
+	if err != nil {
+		return err
+	}
+	o.setLimit(v1.ResourceMemory, *quantity)
+	return nil
+}
+
+func (o *createOptions) setLimit(name v1.ResourceName, quantity resource.Quantity) {
+	if o.limits == nil {
+		o.limits = v1.ResourceList{}
+	}
+	o.limits[name] = quantity
+}
+
+// parseUser parses uid[:gid]. Kubernetes cannot resolve user names from the
+// image, so only numeric ids are accepted.
+func parseUser(o *createOptions, value string) error {
+	user, group, hasGroup := strings.Cut(value, ":")
+	uid, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: user must be a numeric uid", ErrInvalidOption)
+	}
+	o.runAsUser = &uid
+	if hasGroup {
+		gid, err := strconv.ParseInt(group, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: group must be a numeric gid", ErrInvalidOption)
+		}
+		o.runAsGroup = &gid
+	}
+
+	return nil
+}
+
+func parsePrivileged(o *createOptions, value string) error {
+	if value == "" {
+		o.privileged = true
+		return nil
+	}
+	privileged, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	o.privileged = privileged
+	return nil
+}
+
+// capability converts a docker capability name to the Kubernetes form, which
+// has no CAP_ prefix.
+func capability(value string) v1.Capability {
+	return v1.Capability(strings.TrimPrefix(strings.ToUpper(value), "CAP_"))
+}
+
+// parseEnv parses NAME=value. A bare NAME takes its value from the hook's
+// environment and is skipped if unset, like docker does.
+func parseEnv(o *createOptions, value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if name == "" {
+		return fmt.Errorf("%w: missing variable name", ErrInvalidOption)
+	}
+	if !ok {
+		if val, ok = os.LookupEnv(name); !ok {
+			return nil
+		}
+	}
+	o.env = append(o.env, v1.EnvVar{Name: name, Value: escapeExpansion(val)})
+	return nil
+}
+
+func parseShmSize(o *createOptions, value string) error {
+	size, err := parseBytes(value)
+	if err != nil {
+		return err
+	}
+	o.shmSize = size
+	return nil
+}
+
+// durationFlag returns a parser for a flag holding a duration such as 10s.
+func durationFlag(field func(o *createOptions) *time.Duration) func(o *createOptions, value string) error {
+	return func(o *createOptions, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%w: %q is not a duration such as 10s", ErrInvalidOption, value)
+		}
+		*field(o) = d
+		return nil
+	}
+}
+
+func parseHealthRetries(o *createOptions, value string) error {
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries <= 0 {
+		return fmt.Errorf("%w: retries must be a positive number", ErrInvalidOption)
+	}
+	o.health.Retries = retries
+	return nil
+}
+
+// parseUlimit always fails: Kubernetes has no per-container resource limits
+// of this kind, they are set by the container runtime on the node.
+func parseUlimit(*createOptions, string) error {
+	return fmt.Errorf("%w: Kubernetes cannot set ulimits per container; configure them in the node's container runtime", ErrUnsupportedOption)
+}
+
+// parseTmpfs parses path[:options], honouring the size option.
+func parseTmpfs(o *createOptions, value string) error {
+	path, options, _ := strings.Cut(value, ":")
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%w: path must be absolute", ErrInvalidOption)
+	}
+	mount := tmpfsMount{path: path}
+	for opt := range strings.SplitSeq(options, ",") {
+		if size, ok := strings.CutPrefix(opt, "size="); ok {
+			quantity, err := parseBytes(size)
+			if err != nil {
+				return err
+			}
+			mount.size = quantity
+		}
+	}
+	o.tmpfs = append(o.tmpfs, mount)
+	return nil
+}
+
+func parseHostname(o *createOptions, value string) error {
+	if errs := validation.IsDNS1123Label(value); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidOption, strings.Join(errs, ", "))
+	}
+	o.hostname = value
+	return nil
+}
+
+func parseNetworkAlias(o *createOptions, value string) error {
+	if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidOption, strings.Join(errs, ", "))
+	}
+	o.networkAliases = append(o.networkAliases, value)
+	return nil
+}
+
+// parseAddHost parses host:ip or host=ip.
+func parseAddHost(o *createOptions, value string) error {
+	host, ip, ok := strings.Cut(value, "=")
+	if !ok {
+		host, ip, ok = strings.Cut(value, ":")
+	}
+	if !ok || host == "" {
+		return fmt.Errorf("%w: expected host:ip", ErrInvalidOption)
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%w: %q is not an IP address", ErrInvalidOption, ip)
+	}
+	for i, alias := range o.hostAliases {
+		if alias.IP == ip {
+			o.hostAliases[i].Hostnames = append(o.hostAliases[i].Hostnames, host)
+			return nil
+		}
+	}
+	o.hostAliases = append(o.hostAliases, v1.HostAlias{IP: ip, Hostnames: []string{host}})
+	return nil
+}
+
+// parseBytes parses a docker byte size such as 512m, 1.5g or 2GiB, as docker
+// does, so the units are powers of 1024.
+func parseBytes(value string) (*resource.Quantity, error) {
+	n, err := units.RAMInBytes(value)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("%w: %q is not a size such as 512m or 1g", ErrInvalidOption, value)
+	}
+
+	return resource.NewQuantity(n, resource.BinarySI), nil
+}
+
+// splitArgs splits a command line into arguments, honouring single quotes,
+// double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("%w: unterminated quote or escape in %q", ErrInvalidOption, s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
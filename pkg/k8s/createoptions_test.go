@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseCreateOptions(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		options string
+		check   func(t *testing.T, pod *v1.Pod, container *v1.Container)
+		wantErr error
+	}{
+		"resources": {
+			options: "--cpus 1.5 --memory=512m",
+			check: func(t *testing.T, _ *v1.Pod, c *v1.Container) {
+				t.Helper()
+				if got := c.Resources.Limits[v1.ResourceCPU]; got.Cmp(resource.MustParse("1500m")) != 0 {
+					t.Errorf("cpu limit = %s, want 1500m", got.String())
+				}
+				if got := c.Resources.Limits[v1.ResourceMemory]; got.Cmp(resource.MustParse("512Mi")) != 0 {
+					t.Errorf("memory limit = %s, want 512Mi", got.String())
+				}
+			},
+		},
+		"security context": {
+			options: "--user 1000:1001 --privileged --cap-add CAP_NET_ADMIN --cap-drop=ALL",
+			check: func(t *testing.T, _ *v1.Pod, c *v1.Container) {
+				t.Helper()
+				sc := c.SecurityContext
+				if sc == nil || *sc.RunAsUser != 1000 || *sc.RunAsGroup != 1001 || !*sc.Privileged {
+					t.Fatalf("security context = %+v, want user 1000:1001 and privileged", sc)
+				}
+				if !reflect.DeepEqual(sc.Capabilities.Add, []v1.Capability{"NET_ADMIN"}) || !reflect.DeepEqual(sc.Capabilities.Drop, []v1.Capability{"ALL"}) {
+					t.Errorf("capabilities = %+v, want add NET_ADMIN and drop ALL", sc.Capabilities)
+				}
+			},
+		},
+		"environment and working directory": {
+			options: `-e FOO=bar --env "GREETING=hello world" -eX=1 -w /src`,
+			check: func(t *testing.T, _ *v1.Pod, c *v1.Container) {
+				t.Helper()
+				want := []v1.EnvVar{{Name: "FOO", Value: "bar"}, {Name: "GREETING", Value: "hello world"}, {Name: "X", Value: "1"}}
+				if !reflect.DeepEqual(c.Env, want) {
+					t.Errorf("env = %+v, want %+v", c.Env, want)
+				}
+				if c.WorkingDir != "/src" {
+					t.Errorf("working dir = %q, want /src", c.WorkingDir)
+				}
+			},
+		},
+		"entrypoint": {
+			options: "--entrypoint /bin/server",
+			check: func(t *testing.T, _ *v1.Pod, c *v1.Container) {
+				t.Helper()
+				if !reflect.DeepEqual(c.Command, []string{"/bin/server"}) {
+					t.Errorf("command = %v, want [/bin/server]", c.Command)
+				}
+			},
+		},
+		"memory volumes": {
+			options: "--shm-size 1g --tmpfs /run:rw,size=64m",
+			check: func(t *testing.T, pod *v1.Pod, c *v1.Container) {
+				t.Helper()
+				if len(pod.Spec.Volumes) != 2 || len(c.VolumeMounts) != 2 {
+					t.Fatalf("volumes = %+v, mounts = %+v, want 2 each", pod.Spec.Volumes, c.VolumeMounts)
+				}
+				if c.VolumeMounts[0].MountPath != "/dev/shm" || c.VolumeMounts[1].MountPath != "/run" {
+					t.Errorf("mounts = %+v, want /dev/shm and /run", c.VolumeMounts)
+				}
+				if c.VolumeMounts[0].Name != "tmpfs-0" || c.VolumeMounts[1].Name != "tmpfs-1" {
+					t.Errorf("mounts = %+v, want volumes tmpfs-0 and tmpfs-1", c.VolumeMounts)
+				}
+				for _, vol := range pod.Spec.Volumes {
+					if vol.EmptyDir == nil || vol.EmptyDir.Medium != v1.StorageMediumMemory {
+						t.Errorf("volume %s = %+v, want memory emptyDir", vol.Name, vol.VolumeSource)
+					}
+				}
+				if got := pod.Spec.Volumes[1].EmptyDir.SizeLimit; got.Cmp(resource.MustParse("64Mi")) != 0 {
+					t.Errorf("tmpfs size = %s, want 64Mi", got.String())
+				}
+			},
+		},
+		"hostname and hosts": {
+			options: "--hostname build --add-host db:10.0.0.1 --add-host=cache=10.0.0.1 --add-host v6:2001:db8::1",
+			check: func(t *testing.T, pod *v1.Pod, _ *v1.Container) {
+				t.Helper()
+				if pod.Spec.Hostname != "build" {
+					t.Errorf("hostname = %q, want build", pod.Spec.Hostname)
+				}
+				want := []v1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"db", "cache"}}, {IP: "2001:db8::1", Hostnames: []string{"v6"}}}
+				if !reflect.DeepEqual(pod.Spec.HostAliases, want) {
+					t.Errorf("host aliases = %+v, want %+v", pod.Spec.HostAliases, want)
+				}
+			},
+		},
+		"unknown flag": {
+			options: "--cpus 1 --network host",
+			wantErr: ErrUnsupportedOption,
+		},
+		"ulimit": {
+			options: "--ulimit nofile=1024:1024",
+			wantErr: ErrUnsupportedOption,
+		},
+		"missing value": {
+			options: "--memory",
+			wantErr: ErrInvalidOption,
+		},
+		"bad memory": {
+			options: "--memory lots",
+			wantErr: ErrInvalidOption,
+		},
+		"user name": {
+			options: "--user postgres",
+			wantErr: ErrInvalidOption,
+		},
+		"bad host": {
+			options: "--add-host db:not-an-ip",
+			wantErr: ErrInvalidOption,
+		},
+		"unterminated quote": {
+			options: `-e "FOO=bar`,
+			wantErr: ErrInvalidOption,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			options, err := parseCreateOptions(tt.options)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("parseCreateOptions() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCreateOptions() unexpected error = %v", err)
+			}
+
+			pod := &v1.Pod{}
+			container := &v1.Container{}
+			options.apply(pod, container)
+			tt.check(t, pod, container)
+		})
+	}
+}
+
+func TestCreateOptionsContainerChecks(t *testing.T) {
+	t.Parallel()
+	options, err := parseCreateOptions("--entrypoint /bin/sh --hostname svc")
+	if err != nil {
+		t.Fatalf("parseCreateOptions() unexpected error = %v", err)
+	}
+	if err := options.checkJobContainer(); !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("checkJobContainer() error = %v, want %v", err, ErrUnsupportedOption)
+	}
+	if err := options.checkServiceContainer(); !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("checkServiceContainer() error = %v, want %v", err, ErrUnsupportedOption)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		"bytes":          {value: "1024", want: 1 << 10},
+		"byte suffix":    {value: "512b", want: 512},
+		"megabytes":      {value: "512m", want: 512 << 20},
+		"long suffix":    {value: "512mb", want: 512 << 20},
+		"binary suffix":  {value: "2GiB", want: 2 << 30},
+		"fraction":       {value: "1.5g", want: 3 << 29},
+		"terabytes":      {value: "1t", want: 1 << 40},
+		"zero":           {value: "0", wantErr: true},
+		"negative":       {value: "-1m", wantErr: true},
+		"unknown suffix": {value: "1x", wantErr: true},
+		"no number":      {value: "m", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseBytes(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidOption) {
+					t.Fatalf("parseBytes(%q) error = %v, want %v", tt.value, err, ErrInvalidOption)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBytes(%q) unexpected error = %v", tt.value, err)
+			}
+			if got.Value() != tt.want {
+				t.Errorf("parseBytes(%q) = %d, want %d", tt.value, got.Value(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+)
+
+var ErrPodNotDeleted = errors.New("pod was not deleted")
+
+// forceDeleteTimeout is how long a force deleted pod may take to go away. It
+// is kept free at the end of the context so the force delete still happens.
+const forceDeleteTimeout = 10 * time.Second
+
+// DeletePod deletes a pod with the configured grace period and waits until it
+// is gone. Without a configured grace period, pods kept alive by tail are
+// deleted immediately, since tail ignores SIGTERM as PID 1 and would hold up
+// the deletion for the pod's whole grace period. A pod that is still
+// terminating after the delete timeout is force deleted. A pod that does not
+// exist counts as deleted.
+func (c *K8sClient) DeletePod(ctx context.Context, name string) error {
+	opts := v1Meta.DeleteOptions{}
+	if grace := int64(c.cfg.DeleteGracePeriodSeconds); grace >= 0 {
+		opts.GracePeriodSeconds = &grace
+	} else if c.keptAlive(name) {
+		opts.GracePeriodSeconds = new(int64(0))
+	}
+	if err := c.deletePod(ctx, name, opts); err != nil {
+		return err
+	}
+
+	timeout := time.Duration(c.cfg.DeleteTimeoutSeconds) * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline)-forceDeleteTimeout)
+	}
+	gone, err := c.waitForPodGone(ctx, name, timeout)
+	if gone || err != nil {
+		return err
+	}
+
+	slog.Warn("Pod is stuck terminating, force deleting it", "pod", name, "timeout", timeout)
+	if err := c.deletePod(ctx, name, v1Meta.DeleteOptions{GracePeriodSeconds: new(int64(0))}); err != nil {
+		return err
+	}
+	gone, err = c.waitForPodGone(ctx, name, forceDeleteTimeout)
+	if err != nil {
+		return err
+	}
+	if !gone {
+		return fmt.Errorf("%w: %s is still terminating", ErrPodNotDeleted, name)
+	}
+
+	return nil
+}
+
+// keptAlive reports whether the hook keeps pod name alive with
+// `tail -f /dev/null`: the job pod, and step pods unless steps run as the
+// container command.
+func (c *K8sClient) keptAlive(name string) bool {
+	if name == c.jobPodName() {
+		return true
+	}
+	return strings.HasPrefix(name, c.GetRunnerPodName()+"-step-") && c.cfg.ContainerStepMode == config.ContainerStepModeExec
+}
+
+func (c *K8sClient) deletePod(ctx context.Context, name string, opts v1Meta.DeleteOptions) error {
+	err := c.client.CoreV1().Pods(c.GetNS()).Delete(ctx, name, opts)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("pod %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// waitForPodGone waits up to timeout for pod name to disappear, watching it
+// if possible and polling otherwise. It returns false without an error if the
+// pod is still there after the timeout.
+func (c *K8sClient) waitForPodGone(ctx context.Context, name string, timeout time.Duration) (bool, error) {
+	if timeout <= 0 {
+		return c.podGone(ctx, name)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pods := c.client.CoreV1().Pods(c.GetNS())
+	for {
+		pod, err := pods.Get(waitCtx, name, v1Meta.GetOptions{})
+		switch {
+		case k8sErrors.IsNotFound(err):
+			return true, nil
+		case waitCtx.Err() != nil:
+			return podGoneTimeout(ctx, name)
+		case err != nil:
+			return false, fmt.Errorf("pod %s: %w", name, err)
+		}
+
+		w, err := pods.Watch(waitCtx, v1Meta.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+			ResourceVersion: pod.ResourceVersion,
+		})
+		if err != nil {
+			// Without watch permission, or if the watch cannot be set up,
+			// read the pod until it is gone.
+			slog.Debug("Failed to watch pod deletion, polling instead", "pod", name, "err", err)
+			err := wait.PollUntilContextCancel(waitCtx, time.Second, false, func(ctx context.Context) (bool, error) {
+				return c.podGone(ctx, name)
+			})
+			if err != nil && waitCtx.Err() != nil {
+				return podGoneTimeout(ctx, name)
+			}
+			return err == nil, err
+		}
+
+		deleted := watchDeleted(waitCtx, w, name)
+		w.Stop()
+		if deleted {
+			return true, nil
+		}
+		if waitCtx.Err() != nil {
+			return podGoneTimeout(ctx, name)
+		}
+	}
+}
+
+// watchDeleted reports whether w saw pod name being deleted before it closed
+// or ctx was done.
+func watchDeleted(ctx context.Context, w watch.Interface, name string) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-w.ResultChan():
+			if !ok || event.Type == watch.Error {
+				return false
+			}
+			if pod, ok := event.Object.(*v1.Pod); ok && event.Type == watch.Deleted && pod.Name == name {
+				return true
+			}
+		}
+	}
+}
+
+// podGoneTimeout reports whether the pod is gone once waiting for it timed
+// out, or the error of ctx if the caller gave up.
+func podGoneTimeout(ctx context.Context, name string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("waiting for pod %s to be deleted: %w", name, err)
+	}
+	return false, nil
+}
+
+func (c *K8sClient) podGone(ctx context.Context, name string) (bool, error) {
+	_, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("pod %s: %w", name, err)
+	}
+	return false, nil
+}
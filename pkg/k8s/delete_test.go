@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"cmp"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+)
+
+func TestDeletePod(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		exists bool
+		// pod defaults to a pod the hook does not keep alive.
+		pod      string
+		stepMode string
+		grace    int
+		// stuck makes the pod ignore deletes with a grace period.
+		stuck     bool
+		wantGrace []*int64
+	}{
+		"not found": {
+			grace:     -1,
+			wantGrace: []*int64{nil},
+		},
+		"pod grace period": {
+			exists:    true,
+			grace:     -1,
+			wantGrace: []*int64{nil},
+		},
+		// tail ignores SIGTERM, so these would wait out their grace period.
+		"job pod": {
+			exists:    true,
+			pod:       "test-runner-workflow",
+			grace:     -1,
+			stuck:     true,
+			wantGrace: []*int64{new(int64(0))},
+		},
+		"step pod": {
+			exists:    true,
+			pod:       "test-runner-step-abc",
+			stepMode:  config.ContainerStepModeExec,
+			grace:     -1,
+			stuck:     true,
+			wantGrace: []*int64{new(int64(0))},
+		},
+		"step pod running the step": {
+			exists:    true,
+			pod:       "test-runner-step-abc",
+			stepMode:  config.ContainerStepModeDirect,
+			grace:     -1,
+			wantGrace: []*int64{nil},
+		},
+		"job pod with configured grace period": {
+			exists:    true,
+			pod:       "test-runner-workflow",
+			grace:     5,
+			stuck:     true,
+			wantGrace: []*int64{new(int64(5)), new(int64(0))},
+		},
+		"configured grace period": {
+			exists:    true,
+			grace:     5,
+			wantGrace: []*int64{new(int64(5))},
+		},
+		"stuck terminating": {
+			exists:    true,
+			grace:     5,
+			stuck:     true,
+			wantGrace: []*int64{new(int64(5)), new(int64(0))},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := fake.NewClientset()
+			c := K8sClient{client: client, cfg: testConfig()}
+			c.cfg.DeleteGracePeriodSeconds = tt.grace
+			c.cfg.DeleteTimeoutSeconds = 1
+			if tt.stepMode != "" {
+				c.cfg.ContainerStepMode = tt.stepMode
+			}
+			podName := cmp.Or(tt.pod, "other-pod")
+			if tt.exists {
+				pod := &v1.Pod{ObjectMeta: v1Meta.ObjectMeta{Name: podName, Namespace: "default"}}
+				if _, err := client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{}); err != nil {
+					t.Fatalf("Failed to create pod: %v", err)
+				}
+			}
+			var gotGrace []*int64
+			client.PrependReactor("delete", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+				grace := action.(k8sTesting.DeleteAction).GetDeleteOptions().GracePeriodSeconds
+				gotGrace = append(gotGrace, grace)
+				return tt.stuck && (grace == nil || *grace > 0), nil, nil
+			})
+
+			if err := c.DeletePod(t.Context(), podName); err != nil {
+				t.Fatalf("DeletePod() unexpected error = %v", err)
+			}
+			if _, err := client.CoreV1().Pods("default").Get(t.Context(), podName, v1Meta.GetOptions{}); !k8sErrors.IsNotFound(err) {
+				t.Errorf("pod still exists after DeletePod(): %v", err)
+			}
+			if len(gotGrace) != len(tt.wantGrace) {
+				t.Fatalf("DeletePod() sent %d deletes, want %d", len(gotGrace), len(tt.wantGrace))
+			}
+			for i, want := range tt.wantGrace {
+				if (want == nil) != (gotGrace[i] == nil) || (want != nil && *want != *gotGrace[i]) {
+					t.Errorf("delete %d grace period = %v, want %v", i, gotGrace[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// PodStartupError adds what Kubernetes knows about a pod that did not start:
+// its events and the state of its containers.
+type PodStartupError struct {
+	Err        error
+	Pod        string
+	Events     []v1.Event
+	Containers []string
+	// Message is the pod's status message, set for instance on eviction.
+	Message string
+}
+
+func (e *PodStartupError) Error() string {
+	msg := e.Err.Error()
+	if warning := e.lastWarning(); warning != nil {
+		msg += fmt.Sprintf(" (%s: %s)", warning.Reason, warning.Message)
+	}
+	return msg
+}
+
+func (e *PodStartupError) Unwrap() error {
+	return e.Err
+}
+
+// Details lists the pod events and container states, after the details of
+// the wrapped error if it has any.
+func (e *PodStartupError) Details() string {
+	var b strings.Builder
+	var detailer interface{ Details() string }
+	if errors.As(e.Err, &detailer) {
+		b.WriteString(detailer.Details())
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, "Pod %s: %s\n", e.Pod, e.Message)
+	}
+	if len(e.Events) > 0 {
+		fmt.Fprintf(&b, "Events for pod %s:\n", e.Pod)
+		for _, event := range e.Events {
+			fmt.Fprintf(&b, "  %s\t%s\t%s", event.Type, event.Reason, strings.TrimSpace(event.Message))
+			if event.Count > 1 {
+				fmt.Fprintf(&b, " (x%d)", event.Count)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(e.Containers) > 0 {
+		b.WriteString("Containers:\n")
+		for _, state := range e.Containers {
+			fmt.Fprintf(&b, "  %s\n", state)
+		}
+	}
+	return b.String()
+}
+
+// lastWarning returns the most recent warning event, which is usually the
+// reason the pod did not start.
+func (e *PodStartupError) lastWarning() *v1.Event {
+	for i := len(e.Events) - 1; i >= 0; i-- {
+		if e.Events[i].Type == v1.EventTypeWarning {
+			return &e.Events[i]
+		}
+	}
+	return nil
+}
+
+// startupError wraps err, the reason pod name did not get ready, with the
+// pod's events and container states. Failing to collect them is logged and
+// does not hide err.
+func (c *K8sClient) startupError(ctx context.Context, name string, err error) error {
+	startupErr := &PodStartupError{Err: err, Pod: name}
+
+	events, listErr := c.client.CoreV1().Events(c.GetNS()).List(ctx, v1Meta.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": name}.String(),
+	})
+	if listErr != nil {
+		slog.Warn("Failed to list pod events", "pod", name, "err", listErr)
+	} else {
+		startupErr.Events = events.Items
+		slices.SortStableFunc(startupErr.Events, func(a, b v1.Event) int {
+			return eventTime(a).Compare(eventTime(b))
+		})
+	}
+
+	pod, getErr := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+	if getErr != nil {
+		slog.Warn("Failed to get pod status", "pod", name, "err", getErr)
+	} else {
+		startupErr.Message = pod.Status.Message
+		for _, status := range pod.Status.InitContainerStatuses {
+			startupErr.Containers = append(startupErr.Containers, "init "+containerState(status))
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			startupErr.Containers = append(startupErr.Containers, containerState(status))
+		}
+	}
+
+	for _, event := range startupErr.Events {
+		if event.Type == v1.EventTypeWarning {
+			slog.Error("Pod event", "pod", name, "reason", event.Reason, "message", event.Message, "count", event.Count)
+		}
+	}
+	for _, state := range startupErr.Containers {
+		slog.Error("Container state", "pod", name, "state", state)
+	}
+	return startupErr
+}
+
+// containerState describes the current and last termination state of a
+// container on one line.
+func containerState(status v1.ContainerStatus) string {
+	state := status.Name + ": " + describeState(status.State)
+	if last := status.LastTerminationState.Terminated; last != nil {
+		state += "; last " + describeState(status.LastTerminationState)
+	}
+	if status.RestartCount > 0 {
+		state += fmt.Sprintf("; restarted %d times", status.RestartCount)
+	}
+	return state
+}
+
+func describeState(state v1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return joinReason("waiting", state.Waiting.Reason, state.Waiting.Message)
+	case state.Terminated != nil:
+		t := state.Terminated
+		return joinReason(fmt.Sprintf("terminated with exit code %d", t.ExitCode), t.Reason, t.Message)
+	case state.Running != nil:
+		return "running"
+	default:
+		return "unknown"
+	}
+}
+
+func joinReason(state, reason, message string) string {
+	if reason != "" {
+		state += " (" + reason + ")"
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		state += ": " + message
+	}
+	return state
+}
+
+// eventTime is when an event last happened. Events from newer components only
+// set EventTime or Series, older ones only LastTimestamp.
+func eventTime(event v1.Event) time.Time {
+	switch {
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
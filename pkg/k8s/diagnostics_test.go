@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestContainerState(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		status v1.ContainerStatus
+		want   string
+	}{
+		"waiting": {
+			status: v1.ContainerStatus{Name: "job", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			want:   "job: waiting (ContainerCreating)",
+		},
+		"crash loop with last termination": {
+			status: v1.ContainerStatus{
+				Name:                 "redis",
+				RestartCount:         3,
+				State:                v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 40s restarting failed container"}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+			},
+			want: "redis: waiting (CrashLoopBackOff): back-off 40s restarting failed container; last terminated with exit code 137 (OOMKilled); restarted 3 times",
+		},
+		"running": {
+			status: v1.ContainerStatus{Name: "job", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			want:   "job: running",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := containerState(tt.status); got != tt.want {
+				t.Errorf("containerState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartupError(t *testing.T) {
+	t.Parallel()
+	c := K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+	now := time.Now()
+
+	pod := &v1.Pod{
+		ObjectMeta: v1Meta.ObjectMeta{Name: "job-pod", Namespace: "default"},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "job", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		},
+	}
+	if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+	events := []v1.Event{
+		{
+			ObjectMeta:     v1Meta.ObjectMeta{Name: "mount", Namespace: "default"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "job-pod"},
+			Type:           v1.EventTypeWarning,
+			Reason:         "FailedMount",
+			Message:        `MountVolume.SetUp failed for volume "work": not found`,
+			Count:          4,
+			LastTimestamp:  v1Meta.NewTime(now),
+		},
+		{
+			ObjectMeta:     v1Meta.ObjectMeta{Name: "scheduled", Namespace: "default"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "job-pod"},
+			Type:           v1.EventTypeNormal,
+			Reason:         "Scheduled",
+			Message:        "Successfully assigned default/job-pod to node-1",
+			LastTimestamp:  v1Meta.NewTime(now.Add(-time.Minute)),
+		},
+	}
+	for _, event := range events {
+		if _, err := c.client.CoreV1().Events("default").Create(t.Context(), &event, v1Meta.CreateOptions{}); err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+	}
+
+	err := c.startupError(t.Context(), "job-pod", ErrPodTimeout)
+	if !errors.Is(err, ErrPodTimeout) {
+		t.Errorf("startupError() = %v, want it to wrap %v", err, ErrPodTimeout)
+	}
+	if want := `(FailedMount: MountVolume.SetUp failed for volume "work": not found)`; !strings.Contains(err.Error(), want) {
+		t.Errorf("Error() = %q, want it to contain %q", err.Error(), want)
+	}
+
+	var startupErr *PodStartupError
+	if !errors.As(err, &startupErr) {
+		t.Fatalf("startupError() = %T, want *PodStartupError", err)
+	}
+	details := startupErr.Details()
+	for _, want := range []string{
+		"Normal\tScheduled",
+		"Warning\tFailedMount\tMountVolume.SetUp failed for volume \"work\": not found (x4)",
+		"job: waiting (ContainerCreating)",
+	} {
+		if !strings.Contains(details, want) {
+			t.Errorf("Details() = %q, want it to contain %q", details, want)
+		}
+	}
+	if strings.Index(details, "Scheduled") > strings.Index(details, "FailedMount") {
+		t.Errorf("Details() = %q, want events in time order", details)
+	}
+}
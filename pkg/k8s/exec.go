@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+)
+
+// remoteExec is the default ExecFunc, streaming over the exec subresource with
+// the configured transport.
+func (c *K8sClient) remoteExec(ctx context.Context, pod, container string, command []string, opt remotecommand.StreamOptions) error {
+	req := c.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(c.GetNS()).
+		SubResource("exec")
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdin:     opt.Stdin != nil,
+		Stdout:    opt.Stdout != nil,
+		Stderr:    opt.Stderr != nil,
+		TTY:       opt.Tty,
+	}, scheme.ParameterCodec)
+
+	slog.Debug("trying to exec", "req", req.URL().String(), "name", pod, "command", command)
+	t := &execTransport{}
+	var err error
+	if c.cfg.ExecTransport != config.ExecTransportSPDY {
+		if t.websocket, err = remotecommand.NewWebSocketExecutor(c.config, "GET", req.URL().String()); err != nil {
+			slog.Error("Failed to setup WebSocket executor", "err", err)
+			return err
+		}
+	}
+	if c.cfg.ExecTransport != config.ExecTransportWebSocket {
+		if t.spdy, err = remotecommand.NewSPDYExecutor(c.config, "POST", req.URL()); err != nil {
+			slog.Error("Failed to setup SPDY executor", "err", err)
+			return err
+		}
+	}
+
+	err = t.StreamWithContext(ctx, opt)
+	slog.Debug("Exec finished", "name", pod, "transport", t.used)
+	if t.used != c.execTransport {
+		// Logged once, and again only if a later exec had to fall back.
+		slog.Info("Streaming exec", "transport", t.used)
+		c.execTransport = t.used
+	}
+	return err
+}
+
+// execTransport streams over WebSocket, SPDY, or WebSocket with a fallback to
+// SPDY when both are set, and records which one carried the stream.
+type execTransport struct {
+	websocket remotecommand.Executor
+	spdy      remotecommand.Executor
+	used      string
+}
+
+func (t *execTransport) StreamWithContext(ctx context.Context, opt remotecommand.StreamOptions) error {
+	switch {
+	case t.websocket == nil:
+		t.used = config.ExecTransportSPDY
+		return t.spdy.StreamWithContext(ctx, opt)
+	case t.spdy == nil:
+		t.used = config.ExecTransportWebSocket
+		return t.websocket.StreamWithContext(ctx, opt)
+	}
+
+	t.used = config.ExecTransportWebSocket
+	exec, err := remotecommand.NewFallbackExecutor(t.websocket, t.spdy, func(err error) bool {
+		// Same conditions as kubectl: the upgrade was refused, e.g. by a
+		// proxy that does not pass WebSockets, or the proxy is not supported.
+		if !httpstream.IsUpgradeFailure(err) && !httpstream.IsHTTPSProxyError(err) {
+			return false
+		}
+		slog.Info("WebSocket exec failed, falling back to SPDY", "err", err)
+		t.used = config.ExecTransportSPDY
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return exec.StreamWithContext(ctx, opt)
+}
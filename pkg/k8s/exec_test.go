@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+)
+
+type fakeExecutor struct {
+	err    error
+	called bool
+}
+
+func (f *fakeExecutor) Stream(opt remotecommand.StreamOptions) error {
+	return f.StreamWithContext(context.Background(), opt)
+}
+
+func (f *fakeExecutor) StreamWithContext(context.Context, remotecommand.StreamOptions) error {
+	f.called = true
+	return f.err
+}
+
+func TestExecTransport(t *testing.T) {
+	t.Parallel()
+	refused := &httpstream.UpgradeFailureError{Cause: errors.New("403 Forbidden")}
+	broken := errors.New("stream reset")
+	tests := map[string]struct {
+		websocket *fakeExecutor
+		spdy      *fakeExecutor
+		wantUsed  string
+		wantErr   error
+	}{
+		"websocket": {
+			websocket: &fakeExecutor{},
+			spdy:      &fakeExecutor{},
+			wantUsed:  config.ExecTransportWebSocket,
+		},
+		"upgrade refused falls back to spdy": {
+			websocket: &fakeExecutor{err: refused},
+			spdy:      &fakeExecutor{},
+			wantUsed:  config.ExecTransportSPDY,
+		},
+		"other errors do not fall back": {
+			websocket: &fakeExecutor{err: broken},
+			spdy:      &fakeExecutor{},
+			wantUsed:  config.ExecTransportWebSocket,
+			wantErr:   broken,
+		},
+		"websocket only": {
+			websocket: &fakeExecutor{err: refused},
+			wantUsed:  config.ExecTransportWebSocket,
+			wantErr:   refused,
+		},
+		"spdy only": {
+			spdy:     &fakeExecutor{},
+			wantUsed: config.ExecTransportSPDY,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tr := &execTransport{}
+			if tt.websocket != nil {
+				tr.websocket = tt.websocket
+			}
+			if tt.spdy != nil {
+				tr.spdy = tt.spdy
+			}
+
+			err := tr.StreamWithContext(t.Context(), remotecommand.StreamOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("StreamWithContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if tr.used != tt.wantUsed {
+				t.Errorf("used = %q, want %q", tr.used, tt.wantUsed)
+			}
+			if tt.spdy != nil && tt.spdy.called != (tt.wantUsed == config.ExecTransportSPDY) {
+				t.Errorf("spdy called = %v, want %v", tt.spdy.called, tt.wantUsed == config.ExecTransportSPDY)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package k8s
 import (
 	"maps"
 	"os"
+	"slices"
+	"strings"
 
 	v1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/yaml"
@@ -40,6 +42,16 @@ func applyTemplateToPod(pod *v1.Pod, template string) error {
 	}
 	extensionSpec := podExtension.Spec
 	podSpec := &pod.Spec
+	// Memory volumes from container options are added before the template,
+	// so they make way for template volumes of the same name.
+	reserved := append(slices.Clone(podSpec.Volumes), extensionSpec.Volumes...)
+	for _, vol := range extensionSpec.Volumes {
+		if strings.HasPrefix(vol.Name, tmpfsVolumePrefix+"-") && hasVolume(pod, vol.Name) {
+			name := newVolumeName(reserved, tmpfsVolumePrefix)
+			renameVolume(pod, vol.Name, name)
+			reserved = append(reserved, v1.Volume{Name: name})
+		}
+	}
 	podSpec.Volumes = append(podSpec.Volumes, extensionSpec.Volumes...)
 	if extensionSpec.ServiceAccountName != "" {
 		podSpec.ServiceAccountName = extensionSpec.ServiceAccountName
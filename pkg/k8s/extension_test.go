@@ -383,3 +383,47 @@ func Test_applyTemplateToPod_ServiceNotFound(t *testing.T) {
 		t.Errorf("expected redis container to remain unchanged, got %d env vars", len(pod.Spec.Containers[1].Env))
 	}
 }
+
+func Test_applyTemplateToPod_VolumeNameTaken(t *testing.T) {
+	t.Parallel()
+
+	options, err := parseCreateOptions("--shm-size 64m --tmpfs /run")
+	if err != nil {
+		t.Fatalf("parseCreateOptions() unexpected error = %v", err)
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "job", Image: "test:latest"}}}}
+	options.apply(pod, &pod.Spec.Containers[0])
+
+	templatePath := filepath.Join(t.TempDir(), "template.yaml")
+	template := `spec:
+  volumes:
+    - name: tmpfs-0
+      emptyDir: {}
+  containers:
+    - name: $job
+      volumeMounts:
+        - name: tmpfs-0
+          mountPath: /cache
+`
+	if err := os.WriteFile(templatePath, []byte(template), 0o600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := applyTemplateToPod(pod, templatePath); err != nil {
+		t.Fatalf("applyTemplateToPod() failed: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, vol := range pod.Spec.Volumes {
+		if names[vol.Name] {
+			t.Errorf("volume %s is defined twice: %+v", vol.Name, pod.Spec.Volumes)
+		}
+		names[vol.Name] = true
+	}
+	mounts := map[string]string{}
+	for _, mount := range pod.Spec.Containers[0].VolumeMounts {
+		mounts[mount.MountPath] = mount.Name
+	}
+	if mounts["/cache"] != "tmpfs-0" || mounts["/dev/shm"] == "tmpfs-0" || !names[mounts["/dev/shm"]] || !names[mounts["/run"]] {
+		t.Errorf("mounts = %v, volumes = %v, want /cache on the template volume and the rest on their own", mounts, names)
+	}
+}
@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runnerPodLabel ties every object the hook creates to its runner pod.
+const runnerPodLabel = "runner-pod"
+
+// GCOptions controls which orphaned objects CollectGarbage deletes.
+type GCOptions struct {
+	// TTL deletes objects older than this even if their runner pod still
+	// exists. Zero disables it.
+	TTL time.Duration
+	// DryRun only reports what would be deleted.
+	DryRun bool
+}
+
+// GCItem is an object that CollectGarbage deleted or would delete.
+type GCItem struct {
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	RunnerPod string    `json:"runnerPod"`
+	Created   time.Time `json:"created"`
+	Reason    string    `json:"reason"`
+	Deleted   bool      `json:"deleted"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// GCReport lists the orphaned objects found in a namespace.
+type GCReport struct {
+	Namespace string   `json:"namespace"`
+	DryRun    bool     `json:"dryRun"`
+	Items     []GCItem `json:"items"`
+}
+
+// Failed reports whether deleting any of the items failed.
+func (r *GCReport) Failed() bool {
+	for _, item := range r.Items {
+		if item.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// gcObject is the part of a pod or secret CollectGarbage looks at.
+type gcObject struct {
+	kind   string
+	meta   v1Meta.ObjectMeta
+	delete func(ctx context.Context, name string) error
+}
+
+// CollectGarbage deletes the pods and secrets created by the hook for any
+// runner in the namespace whose runner pod no longer exists, or that are
+// older than the TTL. Unlike PrunePods and PruneSecrets it is not limited to
+// the current runner, so it can sweep up after runners that were evicted or
+// scaled away.
+func (c *K8sClient) CollectGarbage(ctx context.Context, opts GCOptions) (*GCReport, error) {
+	report := &GCReport{Namespace: c.GetNS(), DryRun: opts.DryRun, Items: []GCItem{}}
+	listOpts := v1Meta.ListOptions{LabelSelector: runnerPodLabel}
+
+	pods, err := c.client.CoreV1().Pods(c.GetNS()).List(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	secrets, err := c.client.CoreV1().Secrets(c.GetNS()).List(ctx, listOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	var objects []gcObject
+	for _, pod := range pods.Items {
+		objects = append(objects, gcObject{kind: "pod", meta: pod.ObjectMeta, delete: c.DeletePod})
+	}
+	for _, secret := range secrets.Items {
+		objects = append(objects, gcObject{kind: "secret", meta: secret.ObjectMeta, delete: func(ctx context.Context, name string) error {
+			return c.client.CoreV1().Secrets(c.GetNS()).Delete(ctx, name, v1Meta.DeleteOptions{})
+		}})
+	}
+
+	runnerExists := map[string]bool{}
+	for _, obj := range objects {
+		runner := obj.meta.Labels[runnerPodLabel]
+		if runner == obj.meta.Name {
+			// Never delete a runner pod that labels itself.
+			continue
+		}
+		exists, ok := runnerExists[runner]
+		if !ok {
+			_, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, runner, v1Meta.GetOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, fmt.Errorf("failed to look up runner pod %s: %w", runner, err)
+			}
+			exists = err == nil
+			runnerExists[runner] = exists
+		}
+
+		item := GCItem{Kind: obj.kind, Name: obj.meta.Name, RunnerPod: runner, Created: obj.meta.CreationTimestamp.Time}
+		switch {
+		case !exists:
+			item.Reason = "runner pod is gone"
+		case opts.TTL > 0 && time.Since(item.Created) > opts.TTL:
+			item.Reason = fmt.Sprintf("older than %s", opts.TTL)
+		default:
+			continue
+		}
+
+		if !opts.DryRun {
+			slog.Info("Deleting orphaned object", "kind", item.Kind, "name", item.Name, "reason", item.Reason)
+			err := obj.delete(ctx, item.Name)
+			switch {
+			case err == nil, k8sErrors.IsNotFound(err):
+				item.Deleted = true
+			default:
+				item.Error = err.Error()
+			}
+		}
+		report.Items = append(report.Items, item)
+	}
+
+	return report, nil
+}
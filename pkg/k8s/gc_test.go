@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	t.Parallel()
+	meta := func(name, runner string, age time.Duration) v1Meta.ObjectMeta {
+		m := v1Meta.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: v1Meta.NewTime(time.Now().Add(-age)),
+		}
+		if runner != "" {
+			m.Labels = map[string]string{runnerPodLabel: runner}
+		}
+		return m
+	}
+	objects := []struct {
+		pod    *v1.Pod
+		secret *v1.Secret
+	}{
+		{pod: &v1.Pod{ObjectMeta: meta("alive", "", 48*time.Hour)}},
+		{pod: &v1.Pod{ObjectMeta: meta("alive-workflow", "alive", time.Hour)}},
+		{pod: &v1.Pod{ObjectMeta: meta("alive-step-old", "alive", 48*time.Hour)}},
+		{secret: &v1.Secret{ObjectMeta: meta("alive-pull-secret-a", "alive", time.Hour)}},
+		{pod: &v1.Pod{ObjectMeta: meta("gone-workflow", "gone", time.Hour)}},
+		{secret: &v1.Secret{ObjectMeta: meta("gone-pull-secret-b", "gone", time.Hour)}},
+		{secret: &v1.Secret{ObjectMeta: meta("unlabelled", "", 48*time.Hour)}},
+	}
+
+	tests := map[string]struct {
+		opts        GCOptions
+		wantItems   []string
+		wantDeleted bool
+	}{
+		"runner gone": {
+			wantItems:   []string{"pod/gone-workflow", "secret/gone-pull-secret-b"},
+			wantDeleted: true,
+		},
+		"ttl": {
+			opts:        GCOptions{TTL: 24 * time.Hour},
+			wantItems:   []string{"pod/alive-step-old", "pod/gone-workflow", "secret/gone-pull-secret-b"},
+			wantDeleted: true,
+		},
+		"dry run": {
+			opts:      GCOptions{DryRun: true},
+			wantItems: []string{"pod/gone-workflow", "secret/gone-pull-secret-b"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+			for _, obj := range objects {
+				var err error
+				if obj.pod != nil {
+					_, err = c.client.CoreV1().Pods("default").Create(t.Context(), obj.pod, v1Meta.CreateOptions{})
+				} else {
+					_, err = c.client.CoreV1().Secrets("default").Create(t.Context(), obj.secret, v1Meta.CreateOptions{})
+				}
+				if err != nil {
+					t.Fatalf("Failed to create object: %v", err)
+				}
+			}
+
+			report, err := c.CollectGarbage(t.Context(), tt.opts)
+			if err != nil {
+				t.Fatalf("CollectGarbage() unexpected error = %v", err)
+			}
+
+			var got []string
+			for _, item := range report.Items {
+				got = append(got, item.Kind+"/"+item.Name)
+				if item.Deleted != tt.wantDeleted || item.Error != "" {
+					t.Errorf("item %s deleted = %v, error = %q, want deleted %v", item.Name, item.Deleted, item.Error, tt.wantDeleted)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.wantItems) {
+				t.Errorf("CollectGarbage() items = %v, want %v", got, tt.wantItems)
+			}
+
+			pods, _ := c.client.CoreV1().Pods("default").List(t.Context(), v1Meta.ListOptions{})
+			secrets, _ := c.client.CoreV1().Secrets("default").List(t.Context(), v1Meta.ListOptions{})
+			remaining := len(pods.Items) + len(secrets.Items)
+			if want := len(objects) - len(tt.wantItems); tt.wantDeleted && remaining != want {
+				t.Errorf("%d objects remain, want %d", remaining, want)
+			}
+			if !tt.wantDeleted && remaining != len(objects) {
+				t.Errorf("dry run deleted objects, %d remain", remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var ErrServiceUnhealthy = errors.New("container did not become healthy")
+
+// Docker's health check defaults.
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// serviceLogLines is how many log lines are shown for an unhealthy container.
+const serviceLogLines int64 = 20
+
+// ServiceUnhealthyError names the containers that never became healthy, with
+// their last log lines.
+type ServiceUnhealthyError struct {
+	Containers []string
+	Logs       map[string]string
+}
+
+func (e *ServiceUnhealthyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrServiceUnhealthy, strings.Join(e.Containers, ", "))
+}
+
+func (e *ServiceUnhealthyError) Unwrap() error {
+	return ErrServiceUnhealthy
+}
+
+// Details returns the last log lines of every unhealthy container.
+func (e *ServiceUnhealthyError) Details() string {
+	var b strings.Builder
+	for _, name := range e.Containers {
+		logs, ok := e.Logs[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "==> %s <==\n%s", name, logs)
+		if !strings.HasSuffix(logs, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// readinessProbe turns a docker health check into a readiness probe. Docker's
+// start period has no readiness equivalent, so it is added to the failure
+// threshold instead; containerHealth relies on that to tell when a container
+// has used up its retries.
+func readinessProbe(hc *types.Healthcheck) *v1.Probe {
+	if hc == nil || len(hc.Test) == 0 {
+		return nil
+	}
+
+	var command []string
+	switch hc.Test[0] {
+	case "CMD":
+		command = hc.Test[1:]
+	case "CMD-SHELL":
+		command = []string{"/bin/sh", "-c", strings.Join(hc.Test[1:], " ")}
+	default:
+		return nil
+	}
+
+	interval := orDefault(hc.Interval, defaultHealthInterval)
+	retries := hc.Retries
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+	retries += int(math.Ceil(hc.StartPeriod.Seconds() / interval.Seconds()))
+
+	return &v1.Probe{
+		ProbeHandler:     v1.ProbeHandler{Exec: &v1.ExecAction{Command: command}},
+		PeriodSeconds:    seconds(interval),
+		TimeoutSeconds:   seconds(orDefault(hc.Timeout, defaultHealthTimeout)),
+		FailureThreshold: int32(min(retries, math.MaxInt32)), // #nosec G115 -- bounded above
+	}
+}
+
+// containerHealth reports whether every container of a running pod is ready,
+// and names the containers that have failed their readiness probe for longer
+// than its failure threshold allows.
+func containerHealth(pod *v1.Pod, now time.Time) (bool, []string) {
+	ready := true
+	var unhealthy []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			continue
+		}
+		ready = false
+
+		i := slices.IndexFunc(pod.Spec.Containers, func(c v1.Container) bool { return c.Name == status.Name })
+		if i < 0 || status.State.Running == nil {
+			continue
+		}
+		probe := pod.Spec.Containers[i].ReadinessProbe
+		if probe == nil {
+			continue
+		}
+		budget := time.Duration(probe.InitialDelaySeconds+(probe.PeriodSeconds+probe.TimeoutSeconds)*probe.FailureThreshold) * time.Second
+		if now.Sub(status.State.Running.StartedAt.Time) > budget {
+			unhealthy = append(unhealthy, status.Name)
+		}
+	}
+
+	return ready && len(pod.Status.ContainerStatuses) > 0, unhealthy
+}
+
+// unreadyContainers names the containers of pod that are not ready.
+func unreadyContainers(pod *v1.Pod) []string {
+	var names []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// addLogs fetches the last log lines of each container in err.
+func (c *K8sClient) addLogs(ctx context.Context, podName string, err *ServiceUnhealthyError) {
+	err.Logs = make(map[string]string, len(err.Containers))
+	for _, name := range err.Containers {
+		tail := serviceLogLines
+		logs, logErr := c.client.CoreV1().Pods(c.GetNS()).GetLogs(podName, &v1.PodLogOptions{
+			Container: name,
+			TailLines: &tail,
+		}).DoRaw(ctx)
+		if logErr != nil {
+			slog.Warn("Failed to get container logs", "pod", podName, "container", name, "err", logErr)
+			continue
+		}
+		err.Logs[name] = string(logs)
+	}
+}
+
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// seconds rounds d up to whole seconds, with a minimum of one.
+func seconds(d time.Duration) int32 {
+	return int32(max(1, min(math.Ceil(d.Seconds()), math.MaxInt32))) // #nosec G115 -- bounded above
+}
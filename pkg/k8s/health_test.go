@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestReadinessProbe(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		healthcheck *types.Healthcheck
+		want        *v1.Probe
+	}{
+		"no healthcheck": {},
+		"disabled": {
+			healthcheck: &types.Healthcheck{Test: []string{"NONE"}},
+		},
+		"shell command with defaults": {
+			healthcheck: &types.Healthcheck{Test: []string{"CMD-SHELL", "pg_isready -U postgres"}},
+			want: &v1.Probe{
+				ProbeHandler:     v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"/bin/sh", "-c", "pg_isready -U postgres"}}},
+				PeriodSeconds:    30,
+				TimeoutSeconds:   30,
+				FailureThreshold: 3,
+			},
+		},
+		"exec command with start period": {
+			healthcheck: &types.Healthcheck{
+				Test:        []string{"CMD", "redis-cli", "ping"},
+				Interval:    10 * time.Second,
+				Timeout:     1500 * time.Millisecond,
+				StartPeriod: 25 * time.Second,
+				Retries:     5,
+			},
+			want: &v1.Probe{
+				ProbeHandler:     v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"redis-cli", "ping"}}},
+				PeriodSeconds:    10,
+				TimeoutSeconds:   2,
+				FailureThreshold: 8,
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := readinessProbe(tt.healthcheck); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readinessProbe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthOptions(t *testing.T) {
+	t.Parallel()
+	image := &types.Healthcheck{Test: []string{"CMD", "true"}, Interval: time.Minute, Retries: 2}
+	tests := map[string]struct {
+		options string
+		want    *types.Healthcheck
+	}{
+		"image healthcheck": {
+			want: image,
+		},
+		"options override image": {
+			options: "--health-cmd 'pg_isready' --health-interval 5s --health-retries 10",
+			want:    &types.Healthcheck{Test: []string{"CMD-SHELL", "pg_isready"}, Interval: 5 * time.Second, Retries: 10},
+		},
+		"partial override keeps image command": {
+			options: "--health-timeout=3s --health-start-period 1m",
+			want:    &types.Healthcheck{Test: []string{"CMD", "true"}, Interval: time.Minute, Timeout: 3 * time.Second, StartPeriod: time.Minute, Retries: 2},
+		},
+		"disabled": {
+			options: "--no-healthcheck",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			options, err := parseCreateOptions(tt.options)
+			if err != nil {
+				t.Fatalf("parseCreateOptions() unexpected error = %v", err)
+			}
+			if got := options.healthcheck(image); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("healthcheck() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerHealth(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	probe := &v1.Probe{PeriodSeconds: 5, TimeoutSeconds: 1, FailureThreshold: 3} // 18s budget
+	running := func(name string, ready bool, startedAgo time.Duration) v1.ContainerStatus {
+		return v1.ContainerStatus{
+			Name:  name,
+			Ready: ready,
+			State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: v1Meta.NewTime(now.Add(-startedAgo))}},
+		}
+	}
+	pod := func(statuses ...v1.ContainerStatus) *v1.Pod {
+		return &v1.Pod{
+			Spec: v1.PodSpec{Containers: []v1.Container{
+				{Name: jobContainerName},
+				{Name: "postgres", ReadinessProbe: probe},
+			}},
+			Status: v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: statuses},
+		}
+	}
+
+	tests := map[string]struct {
+		pod           *v1.Pod
+		wantReady     bool
+		wantUnhealthy []string
+	}{
+		"all ready": {
+			pod:       pod(running(jobContainerName, true, time.Minute), running("postgres", true, time.Minute)),
+			wantReady: true,
+		},
+		"service starting": {
+			pod: pod(running(jobContainerName, true, time.Minute), running("postgres", false, 10*time.Second)),
+		},
+		"service out of retries": {
+			pod:           pod(running(jobContainerName, true, time.Minute), running("postgres", false, time.Minute)),
+			wantUnhealthy: []string{"postgres"},
+		},
+		"no statuses yet": {
+			pod: pod(),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ready, unhealthy := containerHealth(tt.pod, now)
+			if ready != tt.wantReady || !reflect.DeepEqual(unhealthy, tt.wantUnhealthy) {
+				t.Errorf("containerHealth() = %v, %v, want %v, %v", ready, unhealthy, tt.wantReady, tt.wantUnhealthy)
+			}
+		})
+	}
+}
+
+func TestWaitForPodReadyUnhealthyService(t *testing.T) {
+	t.Parallel()
+	c := K8sClient{
+		client: fake.NewClientset(),
+		cfg:    testConfig(),
+	}
+	c.cfg.PrepareJobTimeoutSeconds = 1
+
+	pod := &v1.Pod{
+		ObjectMeta: v1Meta.ObjectMeta{Name: "job-pod", Namespace: "default"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: jobContainerName}, {Name: "redis"}}},
+	}
+	if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+	pod.Status = v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{
+		{Name: jobContainerName, Ready: true},
+		{Name: "redis", Ready: false},
+	}}
+	time.AfterFunc(100*time.Millisecond, func() {
+		_, _ = c.client.CoreV1().Pods("default").UpdateStatus(context.Background(), pod, v1Meta.UpdateOptions{})
+	})
+
+	err := c.waitForPodReady(t.Context(), "job-pod", "", podReady)
+	var unhealthy *ServiceUnhealthyError
+	if !errors.As(err, &unhealthy) || !reflect.DeepEqual(unhealthy.Containers, []string{"redis"}) {
+		t.Fatalf("waitForPodReady() error = %v, want redis unhealthy", err)
+	}
+	if !strings.Contains(unhealthy.Details(), "==> redis <==") {
+		t.Errorf("Details() = %q, want redis logs", unhealthy.Details())
+	}
+}
@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// loopbackIP is where service containers are reached from the job pod, as
+// they share its network namespace.
+const loopbackIP = "127.0.0.1"
+
+// addLoopbackHostnames makes hostnames resolve to the job pod itself, so steps
+// can reach a service by name as they would on a docker network.
+func addLoopbackHostnames(pod *v1.Pod, hostnames ...string) {
+	i := slices.IndexFunc(pod.Spec.HostAliases, func(a v1.HostAlias) bool { return a.IP == loopbackIP })
+	if i < 0 {
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, v1.HostAlias{IP: loopbackIP})
+		i = len(pod.Spec.HostAliases) - 1
+	}
+	alias := &pod.Spec.HostAliases[i]
+	for _, hostname := range hostnames {
+		if hostname != "" && hostname != "localhost" && !slices.Contains(alias.Hostnames, hostname) {
+			alias.Hostnames = append(alias.Hostnames, hostname)
+		}
+	}
+}
+
+// addJobPodHostAliases points the names that resolve to loopback in the job
+// pod at the job pod's IP, so a container step reaches the same services.
+func (c *K8sClient) addJobPodHostAliases(ctx context.Context, pod *v1.Pod) {
+	jobPod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, c.jobPodName(), v1Meta.GetOptions{})
+	if err != nil {
+		slog.Debug("Job pod not found, services will not be reachable by name", "pod", c.jobPodName(), "err", err)
+		return
+	}
+	if jobPod.Status.PodIP == "" {
+		slog.Warn("Job pod has no IP, services will not be reachable by name", "pod", jobPod.Name)
+		return
+	}
+
+	for _, alias := range jobPod.Spec.HostAliases {
+		if alias.IP == loopbackIP && len(alias.Hostnames) > 0 {
+			pod.Spec.HostAliases = append(pod.Spec.HostAliases, v1.HostAlias{
+				IP:        jobPod.Status.PodIP,
+				Hostnames: alias.Hostnames,
+			})
+		}
+	}
+}
+
+// jobPodName is the name of the pod created by prepare_job.
+func (c *K8sClient) jobPodName() string {
+	return c.GetRunnerPodName() + "-workflow"
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestServiceHostAliases(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		jobOptions string
+		services   []types.ServiceDefinition
+		want       []v1.HostAlias
+	}{
+		"no services": {},
+		"service names": {
+			services: []types.ServiceDefinition{
+				{ContextName: "redis", Image: "redis:7"},
+				{ContextName: "postgres", Image: "postgres:16"},
+			},
+			want: []v1.HostAlias{{IP: loopbackIP, Hostnames: []string{"redis", "postgres"}}},
+		},
+		"network aliases": {
+			jobOptions: "--network-alias app",
+			services: []types.ServiceDefinition{
+				{ContextName: "db", Image: "postgres:16", CreateOptions: "--network-alias database --net-alias=db --add-host cache:10.0.0.1"},
+			},
+			want: []v1.HostAlias{
+				{IP: loopbackIP, Hostnames: []string{"app", "db", "database"}},
+				{IP: "10.0.0.1", Hostnames: []string{"cache"}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := NewOfflineClient(testConfig())
+			cont := types.ContainerDefinition{Image: "node:20", CreateOptions: tt.jobOptions}
+			pod, err := c.preparePodSpec(t.Context(), cont, tt.services, PodTypeJob)
+			if err != nil {
+				t.Fatalf("preparePodSpec() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(pod.Spec.HostAliases, tt.want) {
+				t.Errorf("host aliases = %+v, want %+v", pod.Spec.HostAliases, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerStepHostAliases(t *testing.T) {
+	t.Parallel()
+	c := K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+	jobPod := &v1.Pod{
+		ObjectMeta: v1Meta.ObjectMeta{Name: "test-runner-workflow", Namespace: "default"},
+		Spec: v1.PodSpec{HostAliases: []v1.HostAlias{
+			{IP: loopbackIP, Hostnames: []string{"redis", "database"}},
+			{IP: "10.0.0.1", Hostnames: []string{"cache"}},
+		}},
+		Status: v1.PodStatus{PodIP: "10.1.2.3"},
+	}
+	if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), jobPod, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+
+	pod, err := c.preparePodSpec(t.Context(), types.ContainerDefinition{Image: "alpine"}, nil, PodTypeContainerStep)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	want := []v1.HostAlias{{IP: "10.1.2.3", Hostnames: []string{"redis", "database"}}}
+	if !reflect.DeepEqual(pod.Spec.HostAliases, want) {
+		t.Errorf("host aliases = %+v, want %+v", pod.Spec.HostAliases, want)
+	}
+}
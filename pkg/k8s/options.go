@@ -0,0 +1,52 @@
+package k8s
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecFunc runs command in a container of the named pod, streaming its
+// input and output through opt.
+type ExecFunc func(ctx context.Context, pod, container string, command []string, opt remotecommand.StreamOptions) error
+
+// ClientOption customises a client created by NewK8sClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	clientset     kubernetes.Interface
+	configureREST []func(*rest.Config)
+	exec          ExecFunc
+	wrapExec      []func(ExecFunc) ExecFunc
+}
+
+// WithClientset makes the client use the given clientset instead of
+// connecting to a cluster. Exec requires WithExec in that case.
+func WithClientset(clientset kubernetes.Interface) ClientOption {
+	return func(o *clientOptions) {
+		o.clientset = clientset
+	}
+}
+
+// WithRESTConfig lets fn adjust the REST config before the clientset is created.
+func WithRESTConfig(fn func(*rest.Config)) ClientOption {
+	return func(o *clientOptions) {
+		o.configureREST = append(o.configureREST, fn)
+	}
+}
+
+// WithExec replaces the function used to exec into pods.
+func WithExec(exec ExecFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.exec = exec
+	}
+}
+
+// WithExecWrapper wraps the function used to exec into pods.
+func WithExecWrapper(wrap func(ExecFunc) ExecFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.wrapExec = append(o.wrapExec, wrap)
+	}
+}
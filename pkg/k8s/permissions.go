@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	authv1 "k8s.io/api/authorization/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+)
+
+var ErrMissingPermissions = errors.New("missing RBAC permissions")
+
+// Permission is a namespaced RBAC permission required by the hook.
+type Permission struct {
+	Verb        string
+	Resource    string
+	Subresource string
+}
+
+func (p Permission) String() string {
+	if p.Subresource != "" {
+		return p.Verb + " " + p.Resource + "/" + p.Subresource
+	}
+	return p.Verb + " " + p.Resource
+}
+
+// RequiredPermissions lists every permission the hook needs in the runner
+// namespace.
+var RequiredPermissions = []Permission{
+	{Verb: "create", Resource: "pods"},
+	{Verb: "get", Resource: "pods"},
+	{Verb: "list", Resource: "pods"},
+	{Verb: "delete", Resource: "pods"},
+	{Verb: "create", Resource: "pods", Subresource: "exec"},
+	{Verb: "get", Resource: "pods", Subresource: "log"},
+	{Verb: "list", Resource: "events"},
+	{Verb: "create", Resource: "secrets"},
+	{Verb: "get", Resource: "secrets"},
+	{Verb: "list", Resource: "secrets"},
+	{Verb: "update", Resource: "secrets"},
+	{Verb: "delete", Resource: "secrets"},
+}
+
+// OptionalPermission is a permission the hook can work without.
+type OptionalPermission struct {
+	Permission
+	// Without describes what the hook does if the permission is missing.
+	Without string
+}
+
+// OptionalPermissions lists the permissions the hook uses in the runner
+// namespace when it has them. Clusters older than 1.35 authorize WebSocket
+// exec as get on pods/exec, so it is listed unless exec only uses SPDY.
+func (c *K8sClient) OptionalPermissions() []OptionalPermission {
+	permissions := []OptionalPermission{
+		{Permission: Permission{Verb: "watch", Resource: "pods"}, Without: "falls back to polling"},
+	}
+	switch c.cfg.ExecTransport {
+	case config.ExecTransportAuto:
+		permissions = append(permissions, OptionalPermission{
+			Permission: Permission{Verb: "get", Resource: "pods", Subresource: "exec"},
+			Without:    "exec falls back to SPDY on clusters older than 1.35",
+		})
+	case config.ExecTransportWebSocket:
+		permissions = append(permissions, OptionalPermission{
+			Permission: Permission{Verb: "get", Resource: "pods", Subresource: "exec"},
+			Without:    "exec fails on clusters older than 1.35",
+		})
+	}
+
+	return permissions
+}
+
+// ReviewPermission asks the API server whether the hook's service account is
+// allowed the given permission in the runner namespace.
+func (c *K8sClient) ReviewPermission(ctx context.Context, p Permission) (bool, error) {
+	review := &authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace:   c.GetNS(),
+				Verb:        p.Verb,
+				Resource:    p.Resource,
+				Subresource: p.Subresource,
+			},
+		},
+	}
+	res, err := c.client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, v1Meta.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to review permission %q: %w", p, err)
+	}
+
+	return res.Status.Allowed, nil
+}
+
+// CheckPermissions reviews all RequiredPermissions and returns an
+// ErrMissingPermissions error naming each one that is not granted.
+func (c *K8sClient) CheckPermissions(ctx context.Context) error {
+	var missing []string
+	for _, p := range RequiredPermissions {
+		allowed, err := c.ReviewPermission(ctx, p)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			missing = append(missing, p.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w in namespace %s: %s", ErrMissingPermissions, c.GetNS(), strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	authv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+// fakeClientWithRBAC returns a fake clientset that denies the given permissions
+// and allows everything else.
+func fakeClientWithRBAC(denied ...Permission) *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		createAction, ok := action.(k8sTesting.CreateAction)
+		if !ok {
+			return false, nil, nil
+		}
+		review, ok := createAction.GetObject().(*authv1.SelfSubjectAccessReview)
+		if !ok {
+			return false, nil, nil
+		}
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = true
+		for _, p := range denied {
+			if p.Verb == attrs.Verb && p.Resource == attrs.Resource && p.Subresource == attrs.Subresource {
+				review.Status.Allowed = false
+			}
+		}
+		return true, review, nil
+	})
+	return client
+}
+
+func TestCheckPermissions(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		denied      []Permission
+		wantMissing []string
+	}{
+		"all allowed": {},
+		"exec denied": {
+			denied:      []Permission{{Verb: "create", Resource: "pods", Subresource: "exec"}},
+			wantMissing: []string{"create pods/exec"},
+		},
+		"secrets denied": {
+			denied: []Permission{
+				{Verb: "create", Resource: "secrets"},
+				{Verb: "delete", Resource: "secrets"},
+			},
+			wantMissing: []string{"create secrets", "delete secrets"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := K8sClient{
+				client: fakeClientWithRBAC(tt.denied...),
+				cfg:    testConfig(),
+			}
+			err := c.CheckPermissions(t.Context())
+			if len(tt.wantMissing) == 0 {
+				if err != nil {
+					t.Fatalf("CheckPermissions() unexpected error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrMissingPermissions) {
+				t.Fatalf("CheckPermissions() error = %v, want %v", err, ErrMissingPermissions)
+			}
+			for _, want := range tt.wantMissing {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("CheckPermissions() error = %v, want it to mention %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), ",") + 1; got != len(tt.wantMissing) {
+				t.Errorf("CheckPermissions() reported %d permissions, want %d: %v", got, len(tt.wantMissing), err)
+			}
+		})
+	}
+}
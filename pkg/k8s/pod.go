@@ -6,6 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -16,22 +17,29 @@ import (
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/remotecommand"
+	k8sExec "k8s.io/client-go/util/exec"
 	"k8s.io/client-go/util/homedir"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
 type K8sClient struct {
 	client kubernetes.Interface
 	config *rest.Config
-	ctx    context.Context
+	cfg    *config.Config
+	exec   ExecFunc
+	// owner caches the runner pod owner references; nil until resolved.
+	owner []v1Meta.OwnerReference
+	// execTransport is the exec transport last logged.
+	execTransport string
 }
 
 var (
@@ -41,6 +49,7 @@ var (
 	ErrInvalidPortMapping  = errors.New("invalid port mapping format")
 	ErrInvalidPortNumber   = errors.New("invalid port number")
 	ErrPortOutOfRange      = errors.New("port out of range (1-65535)")
+	ErrExec                = errors.New("failed to run command in pod")
 )
 
 type PodType int
@@ -61,62 +70,156 @@ const (
 	mountPathGithubWorkspace = "/github/workspace"
 )
 
-func NewK8sClient() (*K8sClient, error) {
-	var clientset *kubernetes.Clientset
-	var config *rest.Config
-	var err error
-	// Allow running outside the cluster for testing purposes
-	// creates the in-cluster config
-	config, err = rest.InClusterConfig()
-	// Fall back to local kubernetes auth
-	if err != nil {
-		var kubeconfig *string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-		} else {
-			kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+func NewK8sClient(cfg *config.Config, opts ...ClientOption) (*K8sClient, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &K8sClient{client: o.clientset, cfg: cfg, exec: o.exec}
+	if c.client == nil {
+		restConfig, err := restConfig()
+		if err != nil {
+			return nil, err
 		}
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
+		for _, fn := range o.configureREST {
+			fn(restConfig)
+		}
+
+		// creates the clientset
+		clientset, err := kubernetes.NewForConfig(restConfig)
 		if err != nil {
 			return nil, err
 		}
+		c.client = clientset
+		c.config = restConfig
+	}
+	if c.exec == nil {
+		c.exec = c.remoteExec
+	}
+	for _, wrap := range o.wrapExec {
+		c.exec = wrap(c.exec)
 	}
 
-	// creates the clientset
-	clientset, err = kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
+	return c, nil
+}
+
+func restConfig() (*rest.Config, error) {
+	// Allow running outside the cluster for testing purposes
+	// creates the in-cluster config
+	config, err := rest.InClusterConfig()
+	if err == nil {
+		return config, nil
+	}
+
+	// Fall back to local kubernetes auth
+	var kubeconfig *string
+	if home := homedir.HomeDir(); home != "" {
+		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	} else {
+		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+	return clientcmd.BuildConfigFromFlags("", *kubeconfig)
+}
 
-	return &K8sClient{client: clientset, ctx: context.Background(), config: config}, nil
+// NewOfflineClient creates a client backed by an in-memory clientset. It never
+// talks to the API server, which makes it suitable for rendering pod specs.
+func NewOfflineClient(cfg *config.Config) *K8sClient {
+	// There is no runner pod to own the rendered objects.
+	return &K8sClient{client: fake.NewClientset(), cfg: cfg, owner: []v1Meta.OwnerReference{}}
 }
 
-func (c *K8sClient) CreatePod(args types.InputArgs, podType PodType) (string, error) {
-	podSpec := c.preparePodSpec(args.Container, args.Services, podType)
+func (c *K8sClient) CreatePod(ctx context.Context, args types.InputArgs, podType PodType) (string, error) {
+	podSpec, err := c.RenderPod(ctx, args, podType)
+	if err != nil {
+		// Creating or updating the pull secret needs permissions too.
+		if k8sErrors.IsForbidden(err) {
+			if permErr := c.CheckPermissions(ctx); permErr != nil {
+				return "", fmt.Errorf("%w: %w", err, permErr)
+			}
+		}
+		return "", err
+	}
 	if podType == PodTypeJob {
+		setSpecHash(podSpec)
 		copyExternals()
 	}
-	if args.Container.CreateOptions != "" {
-		return "", fmt.Errorf("%w: CreateOptions provided: %s", ErrNotSupported, args.Container.CreateOptions)
-	}
 
-	pod, err := c.client.CoreV1().Pods(c.GetNS()).Create(c.ctx, podSpec, v1Meta.CreateOptions{})
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Create(ctx, podSpec, v1Meta.CreateOptions{})
 	if err != nil {
-		var statusErr *k8sErrors.StatusError
-		if errors.As(err, &statusErr) {
-			c.checkPermissions()
+		if ctx.Err() != nil {
+			c.cleanupPod(ctx, podSpec)
+			return "", err
+		}
+		if k8sErrors.IsAlreadyExists(err) {
+			// The existing pod is not ours to delete here. The pull secret
+			// is the job's, and goes or stays with the stale pod.
+			return "", fmt.Errorf("%w: %w", ErrPodExists, err)
+		}
+		if k8sErrors.IsForbidden(err) {
+			if permErr := c.CheckPermissions(ctx); permErr != nil {
+				return "", fmt.Errorf("%w: %w", err, permErr)
+			}
+			if strings.Contains(err.Error(), "exceeded quota") {
+				return "", fmt.Errorf("%w: %w", ErrPodStartup, err)
+			}
 		}
 		return "", err
 	}
 
-	if err = c.waitForPodReady(pod.Name); err != nil {
+	ready := podReady
+	if podType == PodTypeContainerStep && c.cfg.ContainerStepMode == config.ContainerStepModeDirect {
+		// The step may be done before the pod could ever be ready.
+		ready = stepStarted
+	}
+	if podType == PodTypeContainerStep {
+		ready = stepCheck(ready, args.Container.Image)
+	}
+	if err = c.waitForPodReady(ctx, pod.Name, pod.ResourceVersion, ready); err != nil {
+		// Nobody will run cleanup for a step pod we never reported, since
+		// cleanup_job only deletes the job pod, or for any pod once the
+		// runner cancelled us. So remove it before giving up.
+		if ctx.Err() != nil || podType != PodTypeJob {
+			c.cleanupPod(ctx, pod)
+		}
 		return "", err
 	}
 
 	return pod.Name, nil
 }
 
-func (c *K8sClient) ExecStepInPod(name string, args types.InputArgs) error {
+// RenderPod returns the pod that CreatePod would submit for the given input,
+// without creating it.
+func (c *K8sClient) RenderPod(ctx context.Context, args types.InputArgs, podType PodType) (*v1.Pod, error) {
+	pod, err := c.preparePodSpec(ctx, args.Container, args.Services, podType)
+	if err != nil {
+		return nil, err
+	}
+	pod.TypeMeta = v1Meta.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+	pod.Namespace = c.GetNS()
+	return pod, nil
+}
+
+// ExecStepInPod runs the entrypoint of a step in the job container of the
+// named pod. The run script carries the step environment, including its
+// secrets, so by default it is piped to sh over the exec stream and never
+// written to the work volume.
+func (c *K8sClient) ExecStepInPod(ctx context.Context, name string, args types.InputArgs) error {
+	if c.cfg.StepScriptMode == config.StepScriptModeFile {
+		return c.execStepFile(ctx, name, args)
+	}
+
+	script, err := runScript(args)
+	if err != nil {
+		slog.Error("Failed to generate run script", "err", err)
+		return err
+	}
+	return c.execInPod(ctx, name, []string{"-e", "-s"}, strings.NewReader(script))
+}
+
+// execStepFile runs the step through a run script written to the runner's
+// temp directory on the work volume.
+func (c *K8sClient) execStepFile(ctx context.Context, name string, args types.InputArgs) error {
 	containerPath, runnerPath, err := c.writeRunScript(args)
 	defer func() {
 		err = os.Remove(runnerPath)
@@ -128,73 +231,77 @@ func (c *K8sClient) ExecStepInPod(name string, args types.InputArgs) error {
 		slog.Error("Failed to write run script", "err", err)
 		return err
 	}
-	err = c.ExecInPod(name, []string{"-e", containerPath})
-	if err != nil {
-		slog.Error("command failed:", "err", err)
-	}
-	return err
+	return c.ExecInPod(ctx, name, []string{"-e", containerPath})
 }
 
-func (c *K8sClient) ExecInPod(name string, command []string) error {
-	req := c.client.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(name).
-		Namespace(c.GetNS()).
-		SubResource("exec")
-	req.VersionedParams(&v1.PodExecOptions{
-		Container: jobContainerName,
-		Command:   append([]string{"sh"}, command...),
-		Stdout:    true,
-		Stderr:    true,
-	}, scheme.ParameterCodec)
-
-	slog.Debug("trying to exec", "req", req.URL().String(), "name", name, "command", command)
-	exec, err := remotecommand.NewSPDYExecutor(c.config, "POST", req.URL())
-	if err != nil {
-		slog.Error("Failed to setup remote executor", "err", err)
-		return err
-	}
+// ExecInPod runs command with sh in the job container of the named pod. If the
+// command ran and exited non-zero, the error is a k8sExec.ExitError carrying
+// its exit code. Any other failure, such as a broken stream or a missing pod,
+// wraps ErrExec, and also ErrMissingShell if the image has no sh.
+func (c *K8sClient) ExecInPod(ctx context.Context, name string, command []string) error {
+	return c.execInPod(ctx, name, command, nil)
+}
 
+func (c *K8sClient) execInPod(ctx context.Context, name string, command []string, stdin io.Reader) error {
 	opt := remotecommand.StreamOptions{
-		Stdin:  nil,
+		Stdin:  stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 		Tty:    false,
 	}
-	cancelCtx, cancel := context.WithCancel(c.ctx)
-	defer cancel()
-	return exec.StreamWithContext(cancelCtx, opt)
+	err := c.exec(ctx, name, jobContainerName, c.shellCommand(command), opt)
+	var exitErr k8sExec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		if c.cfg.ShellHelperImage == "" && missingExecutable(err.Error(), "sh") {
+			return fmt.Errorf("%w %s: %w: %w", ErrExec, name, ErrMissingShell, err)
+		}
+		return fmt.Errorf("%w %s: %w", ErrExec, name, err)
+	}
+
+	return err
 }
 
-func (c *K8sClient) PrunePods() error {
-	podList, err := c.client.CoreV1().Pods(c.GetNS()).List(c.ctx, v1Meta.ListOptions{
+func (c *K8sClient) PrunePods(ctx context.Context) error {
+	podList, err := c.client.CoreV1().Pods(c.GetNS()).List(ctx, v1Meta.ListOptions{
 		LabelSelector: "runner-pod=" + c.GetRunnerPodName(),
 	})
 	if err != nil {
 		return err
 	}
 
+	var errs []error
 	for _, pod := range podList.Items {
 		slog.Info("Pruning pod", "pod", pod.Name)
-		err = c.DeletePod(pod.Name)
-		if err != nil {
-			return err
+		if err := c.DeletePod(ctx, pod.Name); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// DeleteStepPod deletes a container step pod. Its pull secret is shared with
+// the job and the other steps, so it is left for cleanup_job.
+func (c *K8sClient) DeleteStepPod(ctx context.Context, name string) error {
+	return c.DeletePod(ctx, name)
 }
 
-func (c *K8sClient) DeletePod(name string) error {
-	err := c.client.CoreV1().Pods(c.GetNS()).Delete(c.ctx, name, v1Meta.DeleteOptions{})
+// cleanupPod removes a pod that was created but never handed over to the
+// runner, on a context that survives cancellation of ctx. The pull secret
+// goes with the job pod, but not with a step pod.
+func (c *K8sClient) cleanupPod(ctx context.Context, pod *v1.Pod) {
+	cleanupCtx, cancel := CleanupContext(ctx)
+	defer cancel()
+	err := c.DeletePod(cleanupCtx, pod.Name)
+	if pod.Name == c.jobPodName() {
+		err = errors.Join(err, c.deletePullSecret(cleanupCtx))
+	}
 	if err != nil {
-		return err
+		slog.Error("Failed to clean up pod", "pod", pod.Name, "err", err)
 	}
-
-	return nil
 }
 
-func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []types.ServiceDefinition, podType PodType) *v1.Pod {
+func (c *K8sClient) preparePodSpec(ctx context.Context, cont types.ContainerDefinition, services []types.ServiceDefinition, podType PodType) (*v1.Pod, error) {
 	jobContainer := v1.Container{
 		Name:    jobContainerName,
 		Image:   cont.Image,
@@ -225,13 +332,11 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 			},
 		},
 	}
-	if os.Getenv("ENV_DISABLE_IMAGE_PULL") != envTrue {
+	if !c.cfg.DisableImagePull {
 		jobContainer.ImagePullPolicy = v1.PullIfNotPresent
 	}
 
-	for k, v := range cont.EnvironmentVariables {
-		jobContainer.Env = append(jobContainer.Env, v1.EnvVar{Name: k, Value: v})
-	}
+	jobContainer.Env = append(jobContainer.Env, containerEnv(cont.EnvironmentVariables)...)
 
 	if cont.WorkingDirectory != "" {
 		jobContainer.WorkingDir = cont.WorkingDirectory
@@ -248,6 +353,9 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 		workspaceRelativePath := workspace[i+len("_work/"):]
 
 		name = c.GetRunnerPodName() + "-step-" + podPostfix()
+		if c.cfg.ContainerStepMode == config.ContainerStepModeDirect {
+			jobContainer.Command, jobContainer.Args = stepCommand(cont)
+		}
 		jobContainer.VolumeMounts = append([]v1.VolumeMount{
 			{
 				Name:      JobVolumeName,
@@ -261,7 +369,7 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 			},
 		}, jobContainer.VolumeMounts...)
 	} else {
-		name = c.GetRunnerPodName() + "-workflow"
+		name = c.jobPodName()
 		jobContainer.VolumeMounts = append([]v1.VolumeMount{
 			{
 				Name:      JobVolumeName,
@@ -276,6 +384,7 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 			Labels: map[string]string{
 				"runner-pod": c.GetRunnerPodName(),
 			},
+			OwnerReferences: c.ownerReferences(ctx),
 		},
 		Spec: v1.PodSpec{
 			RestartPolicy: v1.RestartPolicyNever,
@@ -293,15 +402,33 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 		},
 	}
 
+	if image := c.cfg.ShellHelperImage; image != "" && (podType == PodTypeJob || c.cfg.ContainerStepMode == config.ContainerStepModeExec) {
+		addShellHelper(pod, &pod.Spec.Containers[0], image, jobContainer.ImagePullPolicy)
+	}
+
+	if cont.CreateOptions != "" {
+		options, err := parseCreateOptions(cont.CreateOptions)
+		if err == nil {
+			err = options.checkJobContainer()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("job container options: %w", err)
+		}
+		options.apply(pod, &pod.Spec.Containers[0])
+		pod.Spec.Containers[0].ReadinessProbe = readinessProbe(options.healthcheck(nil))
+		if podType == PodTypeJob {
+			addLoopbackHostnames(pod, options.networkAliases...)
+		}
+	}
+
 	// Add service containers to the pod (only for job pods)
 	if podType == PodTypeJob && len(services) > 0 {
-		err := c.addServiceContainersToPod(pod, services)
-		if err != nil {
-			slog.Warn("Failed to add service containers to pod", "err", err)
+		if err := c.addServiceContainersToPod(pod, services); err != nil {
+			return nil, err
 		}
 	}
 
-	if os.Getenv("ENV_USE_KUBE_SCHEDULER") == envTrue {
+	if c.cfg.UseKubeScheduler {
 		pod.Spec.Affinity = &v1.Affinity{
 			NodeAffinity: &v1.NodeAffinity{
 				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
@@ -320,35 +447,54 @@ func (c *K8sClient) preparePodSpec(cont types.ContainerDefinition, services []ty
 			},
 		}
 	} else {
-		pod.Spec.NodeName, _ = c.GetPodNodeName(c.GetRunnerPodName())
+		pod.Spec.NodeName, _ = c.GetPodNodeName(ctx, c.GetRunnerPodName())
 	}
-	if cont.Registry != nil {
-		secretName, err := c.createImagePullSecret(cont.Registry)
-		if err != nil {
-			slog.Warn("Failed to create pull secret", "err", err)
-		} else {
-			pod.Spec.ImagePullSecrets = []v1.LocalObjectReference{
-				{
-					Name: secretName,
-				},
-			}
-		}
+	if podType == PodTypeContainerStep {
+		c.addJobPodHostAliases(ctx, pod)
 	}
-	if template := os.Getenv("ENV_HOOK_TEMPLATE_PATH"); template != "" {
+	if template := c.cfg.TemplatePath; template != "" {
 		err := applyTemplateToPod(pod, template)
 		if err != nil {
-			slog.Error("Failed to apply template to container", "err", err, "template", template) // #nosec G706 -- value is operator-supplied env var; anyone who can set it already has full access
+			slog.Error("Failed to apply template to container", "err", err, "template", template) // #nosec G706 -- value is operator-supplied config; anyone who can set it already has full access
 		}
 	}
-	return pod
+	// Volumes are resolved after the template, which may define named volumes.
+	if err := addPodVolumes(pod, cont, services); err != nil {
+		return nil, err
+	}
+	if err := c.addPullSecret(ctx, pod, cont, services, podType); err != nil {
+		return nil, fmt.Errorf("pull secret: %w", err)
+	}
+	return pod, nil
 }
 
-// createServiceContainer creates a container spec for a service
-func (c *K8sClient) createServiceContainer(service types.ServiceDefinition) (*v1.Container, error) {
-	if service.CreateOptions != "" {
-		slog.Warn("CreateOptions not supported for services, ignoring", "service", service.ContextName, "options", service.CreateOptions)
+// addPodVolumes mounts the volumes requested for the job container and the
+// service containers.
+func addPodVolumes(pod *v1.Pod, cont types.ContainerDefinition, services []types.ServiceDefinition) error {
+	workDir := runnerWorkDir()
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if container.Name == jobContainerName {
+			if err := addContainerVolumes(pod, container, workDir, cont.SystemMountVolumes, cont.UserMountVolumes); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, service := range services {
+			if service.ContextName != container.Name {
+				continue
+			}
+			if err := addContainerVolumes(pod, container, workDir, service.SystemMountVolumes, service.UserMountVolumes); err != nil {
+				return err
+			}
+		}
 	}
 
+	return nil
+}
+
+// createServiceContainer creates a container spec for a service
+func (c *K8sClient) createServiceContainer(pod *v1.Pod, service types.ServiceDefinition) (*v1.Container, error) {
 	container := &v1.Container{
 		Name:  service.ContextName,
 		Image: service.Image,
@@ -358,13 +504,11 @@ func (c *K8sClient) createServiceContainer(service types.ServiceDefinition) (*v1
 		},
 	}
 
-	if os.Getenv("ENV_DISABLE_IMAGE_PULL") != envTrue {
+	if !c.cfg.DisableImagePull {
 		container.ImagePullPolicy = v1.PullIfNotPresent
 	}
 
-	for k, v := range service.EnvironmentVariables {
-		container.Env = append(container.Env, v1.EnvVar{Name: k, Value: v})
-	}
+	container.Env = append(container.Env, containerEnv(service.EnvironmentVariables)...)
 
 	if service.WorkingDirectory != "" {
 		container.WorkingDir = service.WorkingDirectory
@@ -385,48 +529,38 @@ func (c *K8sClient) createServiceContainer(service types.ServiceDefinition) (*v1
 		container.Ports = ports
 	}
 
+	hostnames := []string{service.ContextName}
+	healthcheck := service.Healthcheck
+	if service.CreateOptions != "" {
+		options, err := parseCreateOptions(service.CreateOptions)
+		if err == nil {
+			err = options.checkServiceContainer()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("options for service %s: %w", service.ContextName, err)
+		}
+		options.apply(pod, container)
+		healthcheck = options.healthcheck(healthcheck)
+		hostnames = append(hostnames, options.networkAliases...)
+	}
+	container.ReadinessProbe = readinessProbe(healthcheck)
+	addLoopbackHostnames(pod, hostnames...)
+
 	return container, nil
 }
 
-// addServiceContainersToPod adds service containers and their registry secrets to the pod
+// addServiceContainersToPod adds service containers to the pod
 func (c *K8sClient) addServiceContainersToPod(pod *v1.Pod, services []types.ServiceDefinition) error {
 	for _, service := range services {
-		serviceContainer, err := c.createServiceContainer(service)
+		serviceContainer, err := c.createServiceContainer(pod, service)
 		if err != nil {
-			slog.Warn("Failed to create service container", "service", service.ContextName, "err", err)
 			return err
 		}
 		pod.Spec.Containers = append(pod.Spec.Containers, *serviceContainer)
-		c.addServiceRegistrySecret(pod, service)
 	}
 	return nil
 }
 
-// addServiceRegistrySecret creates and adds an image pull secret for a service
-func (c *K8sClient) addServiceRegistrySecret(pod *v1.Pod, service types.ServiceDefinition) {
-	if service.Registry == nil {
-		return
-	}
-
-	secretName, err := c.createImagePullSecret(service.Registry)
-	if err != nil {
-		slog.Warn("Failed to create pull secret for service", "service", service.ContextName, "err", err)
-		return
-	}
-
-	// Check if this secret is already in the list
-	for _, existing := range pod.Spec.ImagePullSecrets {
-		if existing.Name == secretName {
-			return
-		}
-	}
-
-	// Add the secret
-	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, v1.LocalObjectReference{
-		Name: secretName,
-	})
-}
-
 // parsePortMappings parses port mapping strings into ContainerPort objects
 // Supports formats: "80", "8080:80", "80/tcp", "8080:80/tcp"
 func parsePortMappings(portMappings []string) ([]v1.ContainerPort, error) {
@@ -481,8 +615,8 @@ func parsePortMappings(portMappings []string) ([]v1.ContainerPort, error) {
 }
 
 // ExtractServiceInfo extracts service information from a pod
-func (c *K8sClient) ExtractServiceInfo(podName string) ([]types.ServiceInfo, error) {
-	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(c.ctx, podName, v1Meta.GetOptions{})
+func (c *K8sClient) ExtractServiceInfo(ctx context.Context, podName string) ([]types.ServiceInfo, error) {
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, podName, v1Meta.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -508,36 +642,164 @@ func (c *K8sClient) ExtractServiceInfo(podName string) ([]types.ServiceInfo, err
 	return services, nil
 }
 
-func (c *K8sClient) waitForPodReady(name string) error {
-	var err error
-	timeout := getPrepareJobTimeout()
+// podCheck reports whether a pod is where it is waited for, or why it will
+// never get there.
+type podCheck func(pod *v1.Pod, now time.Time) (bool, error)
+
+// waitForPodReady watches pod name from resourceVersion, the version returned
+// when it was created, until ready reports it ready, it fails to start, or the
+// prepare job timeout runs out.
+func (c *K8sClient) waitForPodReady(ctx context.Context, name, resourceVersion string, ready podCheck) error {
+	timeout := c.cfg.PrepareJobTimeoutSeconds
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	factory := informers.NewSharedInformerFactoryWithOptions(
-		c.client,
-		time.Second*10,
-		informers.WithNamespace(c.GetNS()),
-		informers.WithTweakListOptions(func(opt *v1Meta.ListOptions) {
-			opt.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
-		}),
-	)
+	err := c.watchPod(waitCtx, name, resourceVersion, ready)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("waiting for pod %s: %w", name, ctxErr)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = c.timeoutError(ctx, name, timeout)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var unhealthy *ServiceUnhealthyError
+	if errors.As(err, &unhealthy) {
+		c.addLogs(ctx, name, unhealthy)
+	}
+	return c.startupError(ctx, name, err)
+}
+
+// watchPod waits for the pod to get ready with a watch, resuming it when the
+// server closes it and re-reading the pod when the resource version has
+// expired. It falls back to polling when the hook may not watch pods.
+func (c *K8sClient) watchPod(ctx context.Context, name, resourceVersion string, ready podCheck) error {
+	pods := c.client.CoreV1().Pods(c.GetNS())
+	var last *v1.Pod
+
+	// Readiness depends on time as well as on pod updates, since a service
+	// may run out of health check retries without the pod changing.
+	ticker := time.NewTicker(podCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if resourceVersion == "" {
+			pod, err := pods.Get(ctx, name, v1Meta.GetOptions{})
+			if err != nil {
+				return podGetError(name, err)
+			}
+			if done, err := ready(pod, time.Now()); done || err != nil {
+				return err
+			}
+			last, resourceVersion = pod, pod.ResourceVersion
+		}
+
+		w, err := pods.Watch(ctx, v1Meta.ListOptions{
+			FieldSelector:       fields.OneTermEqualSelector("metadata.name", name).String(),
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		switch {
+		case k8sErrors.IsForbidden(err):
+			slog.Info("Not allowed to watch pods, polling instead", "pod", name)
+			return c.pollPod(ctx, name, ready)
+		case isExpired(err):
+			resourceVersion = ""
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to watch pod %s: %w", name, err)
+		}
+
+		done, err := watchEvents(ctx, w, name, ticker.C, ready, &last, &resourceVersion)
+		w.Stop()
+		if done || err != nil {
+			return err
+		}
+	}
+}
 
-	informer := factory.Core().V1().Pods().Informer()
+// watchEvents handles the events of one watch. It returns false without an
+// error when the watch has to be restarted, from resourceVersion or, if that
+// has expired, from a fresh read of the pod.
+func watchEvents(ctx context.Context, w watch.Interface, name string, tick <-chan time.Time, ready podCheck, last **v1.Pod, resourceVersion *string) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-tick:
+			if *last == nil {
+				continue
+			}
+			if done, err := ready(*last, time.Now()); done || err != nil {
+				return true, err
+			}
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			switch event.Type {
+			case watch.Error:
+				err := k8sErrors.FromObject(event.Object)
+				if isExpired(err) {
+					*resourceVersion = ""
+					return false, nil
+				}
+				return false, fmt.Errorf("failed to watch pod %s: %w", name, err)
+			case watch.Bookmark:
+				if pod, ok := event.Object.(*v1.Pod); ok {
+					*resourceVersion = pod.ResourceVersion
+				}
+			case watch.Deleted:
+				return false, fmt.Errorf("%w: %s", ErrPodDeleted, name)
+			case watch.Added, watch.Modified:
+				pod, ok := event.Object.(*v1.Pod)
+				if !ok || pod.Name != name {
+					continue
+				}
+				*last, *resourceVersion = pod, pod.ResourceVersion
+				if done, err := ready(pod, time.Now()); done || err != nil {
+					return true, err
+				}
+			}
+		}
+	}
+}
 
-	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		UpdateFunc: podEventHandler(cancel, &err),
+// pollPod waits for the pod to get ready by reading it periodically.
+func (c *K8sClient) pollPod(ctx context.Context, name string, ready podCheck) error {
+	return wait.PollUntilContextCancel(ctx, podCheckInterval, true, func(ctx context.Context) (bool, error) {
+		pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+		if err != nil {
+			return false, podGetError(name, err)
+		}
+		return ready(pod, time.Now())
 	})
-	if err != nil {
-		return fmt.Errorf("failed to add event handler: %w", err)
+}
+
+func podGetError(name string, err error) error {
+	if k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrPodDeleted, name)
 	}
+	return fmt.Errorf("failed to get pod %s: %w", name, err)
+}
+
+// isExpired reports whether a watch cannot resume from its resource version.
+func isExpired(err error) bool {
+	return k8sErrors.IsGone(err) || k8sErrors.IsResourceExpired(err)
+}
 
-	factory.Start(ctx.Done())
-	<-ctx.Done() // Wait until pod is running, failed, or timeout
-	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-		return fmt.Errorf("timeout waiting for %d seconds for pod to be ready: %w", timeout, ErrPodTimeout)
+// timeoutError explains why a pod was not ready in time: either some of its
+// containers are running but never became healthy, or it never got running.
+func (c *K8sClient) timeoutError(ctx context.Context, name string, timeout int) error {
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+	if err == nil && pod.Status.Phase == v1.PodRunning {
+		if containers := unreadyContainers(pod); len(containers) > 0 {
+			return &ServiceUnhealthyError{Containers: containers}
+		}
 	}
 
-	return err
+	return fmt.Errorf("timeout waiting for %d seconds for pod to be ready: %w", timeout, ErrPodTimeout)
 }
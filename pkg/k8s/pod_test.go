@@ -1,43 +1,321 @@
 package k8s
 
 import (
-	"os"
+	"context"
+	"errors"
+	"io"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	typedCoreV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+	k8sExec "k8s.io/client-go/util/exec"
 
+	"github.com/reMarkable/k8s-hook/pkg/config"
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
+// testConfig returns the default configuration with the names used across tests.
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Namespace = "default"
+	cfg.RunnerPodName = "test-runner"
+	return cfg
+}
+
 func TestK8sClient_waitForPodReady(t *testing.T) {
 	t.Parallel()
+	ready := v1.PodStatus{
+		Phase:             v1.PodRunning,
+		ContainerStatuses: []v1.ContainerStatus{{Name: jobContainerName, Ready: true}},
+	}
 	tests := map[string]struct {
-		want    v1.PodPhase
-		wantErr bool
+		// status is set on the pod before waiting starts.
+		status *v1.PodStatus
+		// update changes the pod while waiting.
+		update  func(ctx context.Context, pods typedCoreV1.PodInterface, pod *v1.Pod) error
+		reactor k8sTesting.WatchReactionFunc
+		wantErr error
 	}{
-		// TODO: Add test cases.
-	}
-	c := K8sClient{
-		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		"ready": {
+			update: func(ctx context.Context, pods typedCoreV1.PodInterface, pod *v1.Pod) error {
+				pod.Status = ready
+				_, err := pods.UpdateStatus(ctx, pod, v1Meta.UpdateOptions{})
+				return err
+			},
+		},
+		"failed": {
+			update: func(ctx context.Context, pods typedCoreV1.PodInterface, pod *v1.Pod) error {
+				pod.Status.Phase = v1.PodFailed
+				_, err := pods.UpdateStatus(ctx, pod, v1Meta.UpdateOptions{})
+				return err
+			},
+			wantErr: ErrPodStartup,
+		},
+		"deleted": {
+			update: func(ctx context.Context, pods typedCoreV1.PodInterface, pod *v1.Pod) error {
+				return pods.Delete(ctx, pod.Name, v1Meta.DeleteOptions{})
+			},
+			wantErr: ErrPodDeleted,
+		},
+		"timeout": {
+			wantErr: ErrPodTimeout,
+		},
+		"watch forbidden": {
+			status: &ready,
+			reactor: func(k8sTesting.Action) (bool, watch.Interface, error) {
+				return true, nil, k8sErrors.NewForbidden(v1.Resource("pods"), "", errors.New("watch not allowed"))
+			},
+		},
+		"watch expired": {
+			status: &ready,
+			reactor: func(k8sTesting.Action) (bool, watch.Interface, error) {
+				w := watch.NewFakeWithChanSize(1, false)
+				w.Error(&k8sErrors.NewResourceExpired("too old resource version").ErrStatus)
+				return true, w, nil
+			},
+		},
 	}
+
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
+			client := fake.NewClientset()
+			if tt.reactor != nil {
+				client.PrependWatchReactor("pods", tt.reactor)
+			}
+			c := K8sClient{client: client, cfg: testConfig()}
+			c.cfg.PrepareJobTimeoutSeconds = 1
+
+			pods := client.CoreV1().Pods("default")
+			pod := &v1.Pod{ObjectMeta: v1Meta.ObjectMeta{Name: "job-pod", Namespace: "default"}}
+			if tt.status != nil {
+				pod.Status = *tt.status
+			}
+			created, err := pods.Create(t.Context(), pod, v1Meta.CreateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to create pod: %v", err)
+			}
+			if tt.update != nil {
+				time.AfterFunc(100*time.Millisecond, func() {
+					if err := tt.update(context.Background(), pods, created.DeepCopy()); err != nil {
+						t.Errorf("Failed to update pod: %v", err)
+					}
+				})
+			}
 
-			gotErr := c.waitForPodReady(name)
-			if gotErr != nil {
-				if !tt.wantErr {
+			gotErr := c.waitForPodReady(t.Context(), pod.Name, created.ResourceVersion, podReady)
+			if tt.wantErr == nil {
+				if gotErr != nil {
 					t.Errorf("waitForPodReady() failed: %v", gotErr)
 				}
 				return
 			}
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Fatalf("waitForPodReady() error = %v, want %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreatePodCancelled(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		podType     PodType
+		wantSecrets int
+	}{
+		"job pod": {
+			podType: PodTypeJob,
+		},
+		// The pull secret is shared with the job and left for cleanup_job.
+		"step pod": {
+			podType:     PodTypeContainerStep,
+			wantSecrets: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := K8sClient{
+				client: fake.NewClientset(),
+				cfg:    testConfig(),
+			}
+			ctx, cancel := context.WithCancel(t.Context())
+			time.AfterFunc(100*time.Millisecond, cancel)
 
-			if tt.wantErr {
-				t.Fatal("waitForPodReady() succeeded unexpectedly")
+			args := types.InputArgs{Container: types.ContainerDefinition{
+				Image:    "example-image",
+				Registry: map[string]string{"username": "user", "password": "secret"},
+			}}
+			_, err := c.CreatePod(ctx, args, tt.podType)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("CreatePod() error = %v, want %v", err, context.Canceled)
+			}
+
+			pods, err := c.client.CoreV1().Pods("default").List(t.Context(), v1Meta.ListOptions{})
+			if err != nil {
+				t.Fatalf("Failed to list pods: %v", err)
+			}
+			secrets, err := c.client.CoreV1().Secrets("default").List(t.Context(), v1Meta.ListOptions{})
+			if err != nil {
+				t.Fatalf("Failed to list secrets: %v", err)
+			}
+			if len(pods.Items) != 0 || len(secrets.Items) != tt.wantSecrets {
+				t.Errorf("CreatePod() left %d pods and %d secrets behind after cancellation, want 0 and %d",
+					len(pods.Items), len(secrets.Items), tt.wantSecrets)
+			}
+		})
+	}
+}
+
+func TestCreatePodFailedStep(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset()
+	client.PrependReactor("create", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8sTesting.CreateAction).GetObject().(*v1.Pod)
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{
+			Name:  jobContainerName,
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ErrImagePull"}},
+		}}
+		return false, nil, nil
+	})
+	c := K8sClient{client: client, cfg: testConfig()}
+
+	args := types.InputArgs{Container: types.ContainerDefinition{Image: "example-image"}}
+	_, err := c.CreatePod(t.Context(), args, PodTypeContainerStep)
+	if !errors.Is(err, ErrImagePull) {
+		t.Fatalf("CreatePod() error = %v, want %v", err, ErrImagePull)
+	}
+	if want := "container step example-image: ErrImagePull"; !strings.Contains(err.Error(), want) {
+		t.Errorf("CreatePod() error = %v, want it to name %q", err, want)
+	}
+
+	pods, err := client.CoreV1().Pods("default").List(t.Context(), v1Meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("CreatePod() left %d step pods behind after a failed start", len(pods.Items))
+	}
+}
+
+func TestExecInPod(t *testing.T) {
+	t.Parallel()
+	streamErr := errors.New("connection reset by peer")
+	tests := map[string]struct {
+		execErr  error
+		wantErr  error
+		wantCode int
+	}{
+		"success": {},
+		"step failed": {
+			execErr:  k8sExec.CodeExitError{Err: errors.New("command terminated with exit code 3"), Code: 3},
+			wantCode: 3,
+		},
+		"stream broke": {
+			execErr: streamErr,
+			wantErr: ErrExec,
+		},
+		"missing shell": {
+			execErr: errors.New(`OCI runtime exec failed: exec failed: unable to start container process: exec: "sh": executable file not found in $PATH: unknown`),
+			wantErr: ErrMissingShell,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := K8sClient{
+				client: fake.NewClientset(),
+				cfg:    testConfig(),
+				exec: func(context.Context, string, string, []string, remotecommand.StreamOptions) error {
+					return tt.execErr
+				},
+			}
+
+			err := c.ExecInPod(t.Context(), "job-pod", []string{"-c", "true"})
+			var exitErr k8sExec.ExitError
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) || errors.As(err, &exitErr) {
+					t.Errorf("ExecInPod() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantCode != 0:
+				if !errors.As(err, &exitErr) || exitErr.ExitStatus() != tt.wantCode {
+					t.Errorf("ExecInPod() error = %v, want exit code %d", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Errorf("ExecInPod() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestExecStepInPod(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		mode      string
+		wantStdin bool
+	}{
+		"stdin": {
+			mode:      config.StepScriptModeStdin,
+			wantStdin: true,
+		},
+		"file": {
+			mode: config.StepScriptModeFile,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cfg := testConfig()
+			cfg.StepScriptMode = tt.mode
+			var gotCommand []string
+			var gotStdin []byte
+			c := K8sClient{
+				client: fake.NewClientset(),
+				cfg:    cfg,
+				exec: func(_ context.Context, _, _ string, command []string, opt remotecommand.StreamOptions) error {
+					gotCommand = command
+					if opt.Stdin != nil {
+						var err error
+						gotStdin, err = io.ReadAll(opt.Stdin)
+						return err
+					}
+					return nil
+				},
+			}
+
+			err := c.ExecStepInPod(t.Context(), "job-pod", types.InputArgs{ContainerDefinition: types.ContainerDefinition{
+				Entrypoint:           "node",
+				EnvironmentVariables: map[string]string{"INPUT_TOKEN": "s3cr3t"},
+			}})
+			if err != nil {
+				t.Fatalf("ExecStepInPod() unexpected error = %v", err)
+			}
+
+			if !tt.wantStdin {
+				if gotStdin != nil || len(gotCommand) != 3 || !strings.HasPrefix(gotCommand[2], "/__w/_temp/run-script-") {
+					t.Errorf("ExecStepInPod() ran %q with stdin %q, want script file", gotCommand, gotStdin)
+				}
+				return
+			}
+			if !slices.Equal(gotCommand, []string{"sh", "-e", "-s"}) {
+				t.Errorf("ExecStepInPod() ran %q, want sh reading stdin", gotCommand)
+			}
+			if !strings.Contains(string(gotStdin), "INPUT_TOKEN=s3cr3t") {
+				t.Errorf("ExecStepInPod() stdin = %q, want run script with environment", gotStdin)
 			}
 		})
 	}
@@ -45,10 +323,9 @@ func TestK8sClient_waitForPodReady(t *testing.T) {
 
 func TestK8sClient_CreatePodSpec(t *testing.T) {
 	t.Parallel()
-	os.Setenv("ACTIONS_RUNNER_KUBERNETES_NAMESPACE", "default")
 	c := K8sClient{
 		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		cfg:    testConfig(),
 	}
 	input := types.ContainerDefinition{
 		Image: "example-image",
@@ -56,7 +333,10 @@ func TestK8sClient_CreatePodSpec(t *testing.T) {
 			"GITHUB_WORKSPACE": "/tmp/workspace",
 		},
 	}
-	pod := c.preparePodSpec(input, nil, PodTypeJob)
+	pod, err := c.preparePodSpec(t.Context(), input, nil, PodTypeJob)
+	if err != nil {
+		t.Fatalf("preparePodSpec() error = %v", err)
+	}
 	if pod.Spec.Containers[0].Image != "example-image" {
 		t.Errorf("expected image 'example-image', got '%s'", pod.Spec.Containers[0].Image)
 	}
@@ -67,7 +347,10 @@ func TestK8sClient_CreatePodSpec(t *testing.T) {
 			t.Errorf("job expected mount path '%s', got '%s'", expectedPaths[i], vol.MountPath)
 		}
 	}
-	jobPod := c.preparePodSpec(input, nil, PodTypeContainerStep)
+	jobPod, err := c.preparePodSpec(t.Context(), input, nil, PodTypeContainerStep)
+	if err != nil {
+		t.Fatalf("preparePodSpec() error = %v", err)
+	}
 	expectedJobPaths := []string{mountPathGithubWorkspace, "/github/file_commands", mountPathWorkDir, mountPathGithubHome, mountPathGithubWorkflow}
 	jobVolumes := jobPod.Spec.Containers[0].VolumeMounts
 	for i, vol := range jobVolumes {
@@ -220,7 +503,7 @@ func TestCreateServiceContainer(t *testing.T) {
 	t.Parallel()
 	c := K8sClient{
 		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		cfg:    testConfig(),
 	}
 
 	tests := map[string]struct {
@@ -296,7 +579,7 @@ func TestCreateServiceContainer(t *testing.T) {
 			wantArgs:     []string{"--flag", "value"},
 			wantErr:      false,
 		},
-		"service with CreateOptions logs warning but succeeds": {
+		"service with CreateOptions": {
 			service: types.ServiceDefinition{
 				ContextName:   "test",
 				Image:         "test:latest",
@@ -307,6 +590,14 @@ func TestCreateServiceContainer(t *testing.T) {
 			wantEnvCount: 2,
 			wantErr:      false,
 		},
+		"service with unsupported CreateOptions": {
+			service: types.ServiceDefinition{
+				ContextName:   "test",
+				Image:         "test:latest",
+				CreateOptions: "--ulimit nofile=1024",
+			},
+			wantErr: true,
+		},
 		"service with invalid port mapping": {
 			service: types.ServiceDefinition{
 				ContextName:  "bad",
@@ -320,7 +611,7 @@ func TestCreateServiceContainer(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			got, err := c.createServiceContainer(tt.service)
+			got, err := c.createServiceContainer(&v1.Pod{}, tt.service)
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("createServiceContainer() expected error, got nil")
@@ -393,7 +684,7 @@ func TestExtractServiceInfo(t *testing.T) {
 	t.Parallel()
 	c := K8sClient{
 		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		cfg:    testConfig(),
 	}
 
 	tests := map[string]struct {
@@ -514,12 +805,12 @@ func TestExtractServiceInfo(t *testing.T) {
 			// Create the pod in the fake clientset
 			pod.Name = "test-pod-" + name
 			pod.Namespace = "default"
-			_, err := c.client.CoreV1().Pods("default").Create(c.ctx, pod, v1Meta.CreateOptions{})
+			_, err := c.client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{})
 			if err != nil {
 				t.Fatalf("Failed to create test pod: %v", err)
 			}
 
-			got, err := c.ExtractServiceInfo(pod.Name)
+			got, err := c.ExtractServiceInfo(t.Context(), pod.Name)
 			if err != nil {
 				t.Errorf("ExtractServiceInfo() unexpected error = %v", err)
 				return
@@ -623,10 +914,9 @@ func verifyServiceContainers(t *testing.T, pod *v1.Pod, services []types.Service
 
 func TestPreparePodSpecWithServices(t *testing.T) {
 	t.Parallel()
-	os.Setenv("ACTIONS_RUNNER_KUBERNETES_NAMESPACE", "default")
 	c := K8sClient{
 		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		cfg:    testConfig(),
 	}
 
 	tests := map[string]struct {
@@ -727,7 +1017,10 @@ func TestPreparePodSpecWithServices(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			pod := c.preparePodSpec(tt.container, tt.services, tt.podType)
+			pod, err := c.preparePodSpec(t.Context(), tt.container, tt.services, tt.podType)
+			if err != nil {
+				t.Fatalf("preparePodSpec() error = %v", err)
+			}
 
 			// Check container count
 			if len(pod.Spec.Containers) != tt.wantContainerCount {
@@ -766,16 +1059,15 @@ func TestCreatePodWithServices(t *testing.T) {
 	t.Parallel()
 	// Note: This test uses a fake clientset, so pod creation succeeds immediately
 	// without actually creating Kubernetes resources
-	os.Setenv("ACTIONS_RUNNER_KUBERNETES_NAMESPACE", "default")
-	os.Setenv("ACTIONS_RUNNER_POD_NAME", "test-runner")
-	os.Setenv("ACTIONS_RUNNER_CLAIM_NAME", "test-claim")
+	cfg := testConfig()
+	cfg.ClaimName = "test-claim"
 
 	// Skip wait for pod ready in tests
-	os.Setenv("ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS", "1")
+	cfg.PrepareJobTimeoutSeconds = 1
 
 	c := K8sClient{
 		client: fake.NewClientset(),
-		ctx:    t.Context(),
+		cfg:    cfg,
 	}
 
 	tests := map[string]struct {
@@ -828,7 +1120,10 @@ func TestCreatePodWithServices(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			pod := c.preparePodSpec(tt.args.Container, tt.args.Services, PodTypeJob)
+			pod, err := c.preparePodSpec(t.Context(), tt.args.Container, tt.args.Services, PodTypeJob)
+			if err != nil {
+				t.Fatalf("preparePodSpec() error = %v", err)
+			}
 
 			if len(pod.Spec.Containers) != tt.wantContainerCount {
 				t.Errorf("CreatePod() container count = %d, want %d", len(pod.Spec.Containers), tt.wantContainerCount)
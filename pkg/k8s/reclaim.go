@@ -0,0 +1,107 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var ErrPodExists = errors.New("pod already exists")
+
+// specHashAnnotation holds the hash of the spec a job pod was rendered with,
+// since the API server adds defaults to the spec it stores.
+const specHashAnnotation = "k8s-hook/spec-hash"
+
+// AdoptJobPod returns the name of the existing job pod if it was rendered
+// from the same spec as args, including the environment and options of its
+// containers, and is ready, so prepare_job can reuse it. Rendering args
+// stores their pull secret, as creating the pod would.
+func (c *K8sClient) AdoptJobPod(ctx context.Context, args types.InputArgs) (string, bool, error) {
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, c.jobPodName(), v1Meta.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if pod.Labels["runner-pod"] != c.GetRunnerPodName() {
+		slog.Info("Existing job pod belongs to a different runner", "pod", pod.Name)
+		return "", false, nil
+	}
+	want, err := c.RenderPod(ctx, args, PodTypeJob)
+	if err != nil {
+		return "", false, err
+	}
+	if hash := pod.Annotations[specHashAnnotation]; hash == "" || hash != specHash(want) {
+		slog.Info("Existing job pod was created for a different job", "pod", pod.Name)
+		return "", false, nil
+	}
+	if ready, err := podReady(pod, time.Now()); !ready || err != nil {
+		slog.Info("Existing job pod is not ready", "pod", pod.Name, "err", err)
+		return "", false, nil
+	}
+
+	return pod.Name, true, nil
+}
+
+// ReclaimJobPod deletes the job pod left behind by an earlier job, together
+// with the secrets created for the runner. A pod of the same name that another
+// runner created is left alone and reported as ErrPodExists.
+func (c *K8sClient) ReclaimJobPod(ctx context.Context) error {
+	name := c.jobPodName()
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get stale pod %s: %w", name, err)
+	}
+	if err == nil && pod.Labels["runner-pod"] != c.GetRunnerPodName() {
+		return fmt.Errorf("%w: %s belongs to runner %q", ErrPodExists, name, pod.Labels["runner-pod"])
+	}
+	slog.Warn("Deleting stale job pod", "pod", name)
+	if err := c.PruneSecrets(ctx); err != nil {
+		return fmt.Errorf("failed to delete secrets of stale pod %s: %w", name, err)
+	}
+	if err := c.DeletePod(ctx, name); err != nil {
+		return fmt.Errorf("failed to delete stale pod: %w", err)
+	}
+
+	return nil
+}
+
+// setSpecHash records the hash of the spec of pod in its annotations.
+func setSpecHash(pod *v1.Pod) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[specHashAnnotation] = specHash(pod)
+}
+
+// specHash returns a hash of the spec of pod. Environment variables are
+// sorted first, as they are rendered from maps.
+func specHash(pod *v1.Pod) string {
+	spec := pod.Spec.DeepCopy()
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			slices.SortStableFunc(containers[i].Env, func(a, b v1.EnvVar) int { return strings.Compare(a.Name, b.Name) })
+		}
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		// A spec always marshals; an empty hash never matches.
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+// staleJobPod creates the job pod that c would render for args, as an
+// earlier job left it behind.
+func staleJobPod(t *testing.T, c *K8sClient, args types.InputArgs, ready bool) {
+	t.Helper()
+	pod, err := c.RenderPod(t.Context(), args, PodTypeJob)
+	if err != nil {
+		t.Fatalf("RenderPod() unexpected error = %v", err)
+	}
+	setSpecHash(pod)
+	pod.Status = v1.PodStatus{Phase: v1.PodRunning}
+	for _, container := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{Name: container.Name, Ready: ready})
+	}
+	if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+}
+
+func TestAdoptJobPod(t *testing.T) {
+	t.Parallel()
+	args := types.InputArgs{
+		Container: types.ContainerDefinition{
+			Image:                "node:20",
+			EnvironmentVariables: map[string]string{"A": "1", "B": "2", "C": "3", "D": "4"},
+		},
+		Services: []types.ServiceDefinition{{ContextName: "redis", Image: "redis:7"}},
+	}
+	with := func(change func(*types.InputArgs)) *types.InputArgs {
+		stale := args
+		stale.Container.EnvironmentVariables = maps.Clone(args.Container.EnvironmentVariables)
+		change(&stale)
+		return &stale
+	}
+	tests := map[string]struct {
+		// stale is the input of the earlier job, nil if there is no pod.
+		stale     *types.InputArgs
+		ready     bool
+		wantAdopt bool
+	}{
+		"matching and ready": {
+			stale:     &args,
+			ready:     true,
+			wantAdopt: true,
+		},
+		"different image": {
+			stale: with(func(a *types.InputArgs) { a.Container.Image = "node:18" }),
+			ready: true,
+		},
+		"different environment": {
+			stale: with(func(a *types.InputArgs) { a.Container.EnvironmentVariables["TOKEN"] = "earlier" }),
+			ready: true,
+		},
+		"different options": {
+			stale: with(func(a *types.InputArgs) { a.Container.CreateOptions = "--cpus 2" }),
+			ready: true,
+		},
+		"not ready": {
+			stale: &args,
+		},
+		"gone": {},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := &K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+			if tt.stale != nil {
+				staleJobPod(t, c, *tt.stale, tt.ready)
+			}
+
+			podName, adopted, err := c.AdoptJobPod(t.Context(), args)
+			if err != nil {
+				t.Fatalf("AdoptJobPod() unexpected error = %v", err)
+			}
+			if adopted != tt.wantAdopt || (adopted && podName != "test-runner-workflow") {
+				t.Errorf("AdoptJobPod() = %q, %v, want adopted %v", podName, adopted, tt.wantAdopt)
+			}
+		})
+	}
+}
+
+func TestReclaimJobPod(t *testing.T) {
+	t.Parallel()
+	c := &K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+	staleJobPod(t, c, types.InputArgs{Container: types.ContainerDefinition{Image: "node:20"}}, true)
+	for _, secret := range []*v1.Secret{
+		{ObjectMeta: v1Meta.ObjectMeta{Name: "test-runner-pull-secret-abc", Namespace: "default", Labels: map[string]string{"runner-pod": "test-runner"}}},
+		{ObjectMeta: v1Meta.ObjectMeta{Name: "unrelated", Namespace: "default"}},
+	} {
+		if _, err := c.client.CoreV1().Secrets("default").Create(t.Context(), secret, v1Meta.CreateOptions{}); err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+	}
+
+	if err := c.ReclaimJobPod(t.Context()); err != nil {
+		t.Fatalf("ReclaimJobPod() unexpected error = %v", err)
+	}
+
+	if _, err := c.client.CoreV1().Pods("default").Get(t.Context(), "test-runner-workflow", v1Meta.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("stale pod still exists: %v", err)
+	}
+	secrets, err := c.client.CoreV1().Secrets("default").List(t.Context(), v1Meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list secrets: %v", err)
+	}
+	if len(secrets.Items) != 1 || secrets.Items[0].Name != "unrelated" {
+		t.Errorf("secrets after reclaim = %+v, want only the unrelated one", secrets.Items)
+	}
+}
+
+func TestReclaimJobPodOfOtherRunner(t *testing.T) {
+	t.Parallel()
+	c := &K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+	pod := &v1.Pod{ObjectMeta: v1Meta.ObjectMeta{
+		Name:      "test-runner-workflow",
+		Namespace: "default",
+		Labels:    map[string]string{"runner-pod": "other-runner"},
+	}}
+	if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), pod, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create pod: %v", err)
+	}
+
+	if err := c.ReclaimJobPod(t.Context()); !errors.Is(err, ErrPodExists) {
+		t.Fatalf("ReclaimJobPod() error = %v, want %v", err, ErrPodExists)
+	}
+
+	if _, err := c.client.CoreV1().Pods("default").Get(t.Context(), pod.Name, v1Meta.GetOptions{}); err != nil {
+		t.Errorf("pod of other runner was deleted: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+
+	"go.podman.io/image/v5/docker/reference"
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var ErrInvalidImage = errors.New("invalid image reference")
+
+// dockerHubServer is the key kubelet looks up Docker Hub credentials by.
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// dockerConfig is the content of a kubernetes.io/dockerconfigjson secret.
+type dockerConfig struct {
+	Auths map[string]registryAuth `json:"auths"`
+}
+
+type registryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Auth is "username:password" in base64, which some runtimes read
+	// instead of the separate fields.
+	Auth string `json:"auth"`
+}
+
+// pullCredentials merges the registry credentials of cont and services into
+// one docker config, or returns nil if none of them has any. The first
+// credentials given for a registry win.
+func pullCredentials(cont types.ContainerDefinition, services []types.ServiceDefinition) (*dockerConfig, error) {
+	config := &dockerConfig{Auths: map[string]registryAuth{}}
+	add := func(image string, registry map[string]string) error {
+		username, password := registry["username"], registry["password"]
+		if username == "" && password == "" {
+			return nil
+		}
+		server, err := registryServer(image, registry["serverUrl"])
+		if err != nil {
+			return err
+		}
+		if existing, ok := config.Auths[server]; ok {
+			if existing.Username != username || existing.Password != password {
+				slog.Warn("Ignoring conflicting credentials for registry", "registry", server, "image", image)
+			}
+			return nil
+		}
+		config.Auths[server] = registryAuth{
+			Username: username,
+			Password: password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+		}
+		return nil
+	}
+
+	if err := add(cont.Image, cont.Registry); err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		if err := add(service.Image, service.Registry); err != nil {
+			return nil, fmt.Errorf("service %s: %w", service.ContextName, err)
+		}
+	}
+
+	if len(config.Auths) == 0 {
+		return nil, nil //nolint:nilnil // no credentials is not an error
+	}
+	return config, nil
+}
+
+// registryServer returns the registry that credentials for image apply to:
+// server if the runner named one, and otherwise the host of the image.
+func registryServer(image, server string) (string, error) {
+	if server != "" {
+		return server, nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %w", ErrInvalidImage, image, err)
+	}
+	if domain := reference.Domain(named); domain != "docker.io" {
+		return domain, nil
+	}
+	return dockerHubServer, nil
+}
+
+// pullSecretName is the name of the one pull secret of the job, which the job
+// pod and all container step pods share.
+func (c *K8sClient) pullSecretName() string {
+	return c.GetRunnerPodName() + "-pull-secret"
+}
+
+// addPullSecret stores the registry credentials of a pod in the job's pull
+// secret and makes the pod use it. The job pod replaces the secret with its
+// own and its services' credentials, or deletes it if it has none, so no job
+// pulls with the credentials of an earlier one; step pods add theirs to it,
+// and use it even without credentials of their own, since their images often
+// come from the registry of the job container.
+func (c *K8sClient) addPullSecret(ctx context.Context, pod *v1.Pod, cont types.ContainerDefinition, services []types.ServiceDefinition, podType PodType) error {
+	if podType != PodTypeJob {
+		services = nil
+	}
+	creds, err := pullCredentials(cont, services)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	switch {
+	case creds != nil:
+		name, err = c.applyPullSecret(ctx, creds, podType != PodTypeJob)
+	case podType == PodTypeJob:
+		err = c.deletePullSecret(ctx)
+	case podType == PodTypeContainerStep:
+		name, err = c.existingPullSecret(ctx)
+	}
+	if err != nil || name == "" {
+		return err
+	}
+
+	pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, v1.LocalObjectReference{Name: name})
+	return nil
+}
+
+// applyPullSecret creates the job's pull secret with creds. If it exists, creds
+// are merged into it, or replace its content unless merge is set.
+func (c *K8sClient) applyPullSecret(ctx context.Context, creds *dockerConfig, merge bool) (string, error) {
+	name := c.pullSecretName()
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return "", err
+	}
+	secrets := c.client.CoreV1().Secrets(c.GetNS())
+	_, err = secrets.Create(ctx, &v1.Secret{
+		ObjectMeta: v1Meta.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"runner-pod": c.GetRunnerPodName(),
+			},
+			OwnerReferences: c.ownerReferences(ctx),
+		},
+		Data: map[string][]byte{v1.DockerConfigJsonKey: data},
+		Type: v1.SecretTypeDockerConfigJson,
+	}, v1Meta.CreateOptions{})
+	if !k8sErrors.IsAlreadyExists(err) {
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", name, err)
+		}
+		return name, nil
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, name, v1Meta.GetOptions{})
+		if err != nil {
+			return err
+		}
+		merged := &dockerConfig{Auths: map[string]registryAuth{}}
+		if merge {
+			if err := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], merged); err != nil || merged.Auths == nil {
+				merged.Auths = map[string]registryAuth{}
+			}
+		}
+		maps.Copy(merged.Auths, creds.Auths)
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{v1.DockerConfigJsonKey: data}
+		_, err = secrets.Update(ctx, secret, v1Meta.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// existingPullSecret returns the name of the job's pull secret if there is one.
+func (c *K8sClient) existingPullSecret(ctx context.Context) (string, error) {
+	name := c.pullSecretName()
+	_, err := c.client.CoreV1().Secrets(c.GetNS()).Get(ctx, name, v1Meta.GetOptions{})
+	switch {
+	case k8sErrors.IsNotFound(err):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// deletePullSecret deletes the job's pull secret. A secret that is already
+// gone is ignored.
+func (c *K8sClient) deletePullSecret(ctx context.Context) error {
+	name := c.pullSecretName()
+	err := c.client.CoreV1().Secrets(c.GetNS()).Delete(ctx, name, v1Meta.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("secret %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestPullCredentials(t *testing.T) {
+	t.Parallel()
+	robot := map[string]string{"username": "robot", "password": `pa"ss\word`}
+	tests := map[string]struct {
+		cont     types.ContainerDefinition
+		services []types.ServiceDefinition
+		want     map[string]registryAuth
+		wantErr  error
+	}{
+		"no credentials": {
+			cont: types.ContainerDefinition{Image: "ghcr.io/org/job:1"},
+		},
+		"registry from image": {
+			cont: types.ContainerDefinition{Image: "ghcr.io/org/job:1", Registry: robot},
+			want: map[string]registryAuth{
+				"ghcr.io": {Username: "robot", Password: `pa"ss\word`, Auth: "cm9ib3Q6cGEic3Ncd29yZA=="},
+			},
+		},
+		"docker hub": {
+			cont: types.ContainerDefinition{Image: "node:22", Registry: map[string]string{"username": "u", "password": "p"}},
+			want: map[string]registryAuth{
+				dockerHubServer: {Username: "u", Password: "p", Auth: "dTpw"},
+			},
+		},
+		"explicit server": {
+			cont: types.ContainerDefinition{
+				Image:    "registry.example.com/job",
+				Registry: map[string]string{"username": "u", "password": "p", "serverUrl": "https://registry.example.com"},
+			},
+			want: map[string]registryAuth{
+				"https://registry.example.com": {Username: "u", Password: "p", Auth: "dTpw"},
+			},
+		},
+		"services merged": {
+			cont: types.ContainerDefinition{Image: "ghcr.io/org/job:1", Registry: robot},
+			services: []types.ServiceDefinition{
+				{ContextName: "db", Image: "registry.example.com/db", Registry: map[string]string{"username": "u", "password": "p"}},
+				{ContextName: "cache", Image: "ghcr.io/org/cache", Registry: map[string]string{"username": "other", "password": "p"}},
+				{ContextName: "public", Image: "redis"},
+			},
+			want: map[string]registryAuth{
+				"ghcr.io":              {Username: "robot", Password: `pa"ss\word`, Auth: "cm9ib3Q6cGEic3Ncd29yZA=="},
+				"registry.example.com": {Username: "u", Password: "p", Auth: "dTpw"},
+			},
+		},
+		"invalid image": {
+			cont:    types.ContainerDefinition{Image: "Not An Image", Registry: robot},
+			wantErr: ErrInvalidImage,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := pullCredentials(tt.cont, tt.services)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("pullCredentials() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("pullCredentials() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || !maps.Equal(got.Auths, tt.want) {
+				t.Errorf("pullCredentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// readPullSecret returns the registries in the job's pull secret.
+func readPullSecret(t *testing.T, c *K8sClient) []string {
+	t.Helper()
+	secret, err := c.client.CoreV1().Secrets("default").Get(t.Context(), c.pullSecretName(), v1Meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get pull secret: %v", err)
+	}
+	if secret.Type != v1.SecretTypeDockerConfigJson {
+		t.Errorf("pull secret type = %s, want %s", secret.Type, v1.SecretTypeDockerConfigJson)
+	}
+	var config dockerConfig
+	if err := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("pull secret is not valid JSON: %v", err)
+	}
+	return slices.Sorted(maps.Keys(config.Auths))
+}
+
+func TestPullSecretSharedWithSteps(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	c := &K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+	creds := map[string]string{"username": "u", "password": "p"}
+	pullSecrets := func(pod *v1.Pod) []v1.LocalObjectReference { return pod.Spec.ImagePullSecrets }
+	want := []v1.LocalObjectReference{{Name: "test-runner-pull-secret"}}
+
+	job, err := c.preparePodSpec(ctx, types.ContainerDefinition{Image: "ghcr.io/org/job", Registry: creds}, nil, PodTypeJob)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	if !slices.Equal(pullSecrets(job), want) {
+		t.Errorf("job pod pull secrets = %v, want %v", pullSecrets(job), want)
+	}
+
+	step, err := c.preparePodSpec(ctx, types.ContainerDefinition{Image: "ghcr.io/org/step"}, nil, PodTypeContainerStep)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	if !slices.Equal(pullSecrets(step), want) {
+		t.Errorf("step pod without credentials pull secrets = %v, want %v", pullSecrets(step), want)
+	}
+
+	step, err = c.preparePodSpec(ctx, types.ContainerDefinition{Image: "registry.example.com/step", Registry: creds}, nil, PodTypeContainerStep)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	if !slices.Equal(pullSecrets(step), want) {
+		t.Errorf("step pod pull secrets = %v, want %v", pullSecrets(step), want)
+	}
+	if got, want := readPullSecret(t, c), []string{"ghcr.io", "registry.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("pull secret registries after step = %v, want %v", got, want)
+	}
+
+	step.Name = "step-pod"
+	if _, err := c.client.CoreV1().Pods("default").Create(ctx, step, v1Meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create step pod: %v", err)
+	}
+	if err := c.DeleteStepPod(ctx, step.Name); err != nil {
+		t.Fatalf("DeleteStepPod() unexpected error = %v", err)
+	}
+	readPullSecret(t, c)
+
+	// A new job pod starts over with only its own credentials.
+	if _, err := c.preparePodSpec(ctx, types.ContainerDefinition{Image: "ghcr.io/org/job", Registry: creds}, nil, PodTypeJob); err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	if got, want := readPullSecret(t, c), []string{"ghcr.io"}; !slices.Equal(got, want) {
+		t.Errorf("pull secret registries after new job = %v, want %v", got, want)
+	}
+
+	// A job without credentials removes those of the earlier job, so its
+	// steps do not pull with them.
+	job, err = c.preparePodSpec(ctx, types.ContainerDefinition{Image: "ghcr.io/org/job"}, nil, PodTypeJob)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	step, err = c.preparePodSpec(ctx, types.ContainerDefinition{Image: "ghcr.io/org/step"}, nil, PodTypeContainerStep)
+	if err != nil {
+		t.Fatalf("preparePodSpec() unexpected error = %v", err)
+	}
+	if len(pullSecrets(job)) != 0 || len(pullSecrets(step)) != 0 {
+		t.Errorf("pull secrets without credentials = %v and %v, want none", pullSecrets(job), pullSecrets(step))
+	}
+	if _, err := c.client.CoreV1().Secrets("default").Get(ctx, c.pullSecretName(), v1Meta.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Errorf("pull secret of earlier job still exists, error = %v", err)
+	}
+}
+
+func TestCreatePodPullSecretForbidden(t *testing.T) {
+	t.Parallel()
+	updateSecrets := Permission{Verb: "update", Resource: "secrets"}
+	client := fakeClientWithRBAC(updateSecrets)
+	client.PrependReactor("update", "secrets", func(k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8sErrors.NewForbidden(v1.Resource("secrets"), "test-runner-pull-secret", errors.New("update not allowed"))
+	})
+	c := K8sClient{client: client, cfg: testConfig()}
+	creds := &dockerConfig{Auths: map[string]registryAuth{"ghcr.io": {Auth: "dTpw"}}}
+	if _, err := c.applyPullSecret(t.Context(), creds, false); err != nil {
+		t.Fatalf("applyPullSecret() unexpected error = %v", err)
+	}
+
+	args := types.InputArgs{Container: types.ContainerDefinition{
+		Image:    "registry.example.com/step",
+		Registry: map[string]string{"username": "u", "password": "p"},
+	}}
+	_, err := c.CreatePod(t.Context(), args, PodTypeContainerStep)
+	if !k8sErrors.IsForbidden(err) || !errors.Is(err, ErrMissingPermissions) || !strings.Contains(err.Error(), updateSecrets.String()) {
+		t.Fatalf("CreatePod() error = %v, want forbidden naming %q", err, updateSecrets)
+	}
+	pods, err := c.client.CoreV1().Pods("default").List(t.Context(), v1Meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list pods: %v", err)
+	}
+	if len(pods.Items) != 0 {
+		t.Errorf("CreatePod() created %d pods without their pull secret", len(pods.Items))
+	}
+}
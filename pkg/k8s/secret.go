@@ -1,58 +1,31 @@
 package k8s
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 
-	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (c *K8sClient) PruneSecrets() error {
-	secretList, err := c.client.CoreV1().Secrets(c.GetNS()).List(c.ctx, v1Meta.ListOptions{
+func (c *K8sClient) PruneSecrets(ctx context.Context) error {
+	secretList, err := c.client.CoreV1().Secrets(c.GetNS()).List(ctx, v1Meta.ListOptions{
 		LabelSelector: fmt.Sprintf("runner-pod=%s", c.GetRunnerPodName()),
 	})
 	if err != nil {
 		return err
 	}
 
+	var errs []error
 	for _, secret := range secretList.Items {
 		slog.Info("Pruning secret", "secret", secret.Name)
-		err = c.client.CoreV1().Secrets(c.GetNS()).Delete(c.ctx, secret.Name, v1Meta.DeleteOptions{})
-		if err != nil {
-			return err
+		err = c.client.CoreV1().Secrets(c.GetNS()).Delete(ctx, secret.Name, v1Meta.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("secret %s: %w", secret.Name, err))
 		}
 	}
 
-	return nil
-}
-
-// createImagePullSecretFromRegistry creates a Kubernetes image pull secret from registry credentials
-func (c *K8sClient) createImagePullSecret(registry map[string]string) (string, error) {
-	if registry == nil {
-		return "", nil
-	}
-	registryURL := registry["serverUrl"]
-	if registryURL == "" {
-		registryURL = "ghcr.io"
-	}
-	authContent := fmt.Sprintf(`{"auths":{"%s":{"username":"%s","password":"%s"}}}`,
-		registryURL, registry["username"], registry["password"])
-	secret := v1.Secret{
-		Immutable: new(true),
-		ObjectMeta: v1Meta.ObjectMeta{
-			Name: c.GetRunnerPodName() + "-pull-secret-" + podPostfix(),
-			Labels: map[string]string{
-				"runner-pod": c.GetRunnerPodName(),
-			},
-		},
-		StringData: map[string]string{".dockerconfigjson": authContent},
-		Type:       v1.SecretTypeDockerConfigJson,
-	}
-	s, err := c.client.CoreV1().Secrets(c.GetNS()).Create(c.ctx, &secret, v1Meta.CreateOptions{})
-	if err != nil {
-		return "", err
-	}
-
-	return s.Name, nil
+	return errors.Join(errs...)
 }
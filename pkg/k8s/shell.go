@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"errors"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+var ErrMissingShell = errors.New("job image has no shell")
+
+const (
+	shellHelperVolumeName    = "hook-shell"
+	shellHelperContainerName = "install-shell"
+	// shellHelperDir holds busybox and a link for each of its applets, so sh
+	// and any tool missing from the image can be found through PATH.
+	shellHelperDir = "/__hook"
+	// shellHelperInstall copies busybox into the shared volume. The links are
+	// relative, so they resolve wherever the volume is mounted.
+	shellHelperInstall = `cp /bin/busybox ` + shellHelperDir + `/busybox && ` +
+		`for applet in $(/bin/busybox --list); do ln -sf busybox "` + shellHelperDir + `/$applet"; done`
+	// shellHelperExec runs its arguments with the injected sh, after the tools
+	// of the image on PATH.
+	shellHelperExec = `PATH="${PATH:+$PATH:}` + shellHelperDir + `" exec ` + shellHelperDir + `/sh "$@"`
+)
+
+// addShellHelper lets container run without a shell or tail of its own. An
+// init container copies the static busybox of image into an emptyDir, which
+// container then uses for its keepalive command and the shell that steps are
+// run with.
+func addShellHelper(pod *v1.Pod, container *v1.Container, image string, pullPolicy v1.PullPolicy) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name:         shellHelperVolumeName,
+		VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+	})
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, v1.Container{
+		Name:            shellHelperContainerName,
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
+		Command:         []string{"/bin/busybox", "sh", "-c", shellHelperInstall},
+		VolumeMounts: []v1.VolumeMount{
+			{Name: shellHelperVolumeName, MountPath: shellHelperDir},
+		},
+	})
+
+	container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+		Name:      shellHelperVolumeName,
+		MountPath: shellHelperDir,
+		ReadOnly:  true,
+	})
+	container.Command = []string{shellHelperDir + "/busybox"}
+	container.Args = []string{"tail", "-f", "/dev/null"}
+}
+
+// shellCommand returns the command that runs sh with args in the job
+// container, using the injected shell if there is one.
+func (c *K8sClient) shellCommand(args []string) []string {
+	if c.cfg.ShellHelperImage == "" {
+		return append([]string{"sh"}, args...)
+	}
+	return append([]string{shellHelperDir + "/sh", "-c", shellHelperExec, "sh"}, args...)
+}
+
+// missingExecutable reports whether message says that the runtime could not
+// find the named executable in the container, as it does for images without
+// a shell or tail.
+func missingExecutable(message, name string) bool {
+	return strings.Contains(message, `"`+name+`"`) &&
+		(strings.Contains(message, "executable file not found") || strings.Contains(message, "no such file or directory"))
+}
@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestShellHelper(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		image     string
+		podType   PodType
+		stepMode  string
+		wantAdded bool
+	}{
+		"disabled": {
+			podType: PodTypeJob,
+		},
+		"job pod": {
+			image:     "busybox:musl",
+			podType:   PodTypeJob,
+			wantAdded: true,
+		},
+		"container step": {
+			image:     "busybox:musl",
+			podType:   PodTypeContainerStep,
+			stepMode:  config.ContainerStepModeExec,
+			wantAdded: true,
+		},
+		"container step without exec": {
+			image:    "busybox:musl",
+			podType:  PodTypeContainerStep,
+			stepMode: config.ContainerStepModeDirect,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			cfg := testConfig()
+			cfg.ShellHelperImage = tt.image
+			if tt.stepMode != "" {
+				cfg.ContainerStepMode = tt.stepMode
+			}
+			c := K8sClient{client: fake.NewClientset(), cfg: cfg}
+
+			pod, err := c.preparePodSpec(t.Context(), types.ContainerDefinition{Image: "gcr.io/distroless/static"}, nil, tt.podType)
+			if err != nil {
+				t.Fatalf("preparePodSpec() unexpected error = %v", err)
+			}
+			job := pod.Spec.Containers[0]
+			added := len(pod.Spec.InitContainers) == 1
+			if added != tt.wantAdded {
+				t.Fatalf("shell helper added = %v, want %v", added, tt.wantAdded)
+			}
+			if !added {
+				if tt.podType == PodTypeJob && !slices.Equal(job.Command, []string{"tail"}) {
+					t.Errorf("job command = %q, want tail", job.Command)
+				}
+				if got := c.shellCommand([]string{"-e", "script"}); tt.image == "" && !slices.Equal(got, []string{"sh", "-e", "script"}) {
+					t.Errorf("shellCommand() = %q, want plain sh", got)
+				}
+				return
+			}
+
+			init := pod.Spec.InitContainers[0]
+			if init.Image != tt.image || init.VolumeMounts[0].MountPath != shellHelperDir {
+				t.Errorf("init container = %+v, want %s mounting %s", init, tt.image, shellHelperDir)
+			}
+			if !slices.Equal(job.Command, []string{shellHelperDir + "/busybox"}) || !slices.Equal(job.Args, []string{"tail", "-f", "/dev/null"}) {
+				t.Errorf("job command = %q %q, want busybox tail", job.Command, job.Args)
+			}
+			if !isMounted(&job, shellHelperDir) {
+				t.Errorf("job container does not mount %s", shellHelperDir)
+			}
+			got := c.shellCommand([]string{"-e", "script"})
+			if got[0] != shellHelperDir+"/sh" || !slices.Equal(got[len(got)-2:], []string{"-e", "script"}) {
+				t.Errorf("shellCommand() = %q, want injected sh", got)
+			}
+		})
+	}
+}
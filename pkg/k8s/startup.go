@@ -0,0 +1,172 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Startup failures that will not resolve by waiting. They all wrap
+// ErrPodStartup.
+var (
+	ErrImagePull       = fmt.Errorf("%w: image could not be pulled", ErrPodStartup)
+	ErrContainerConfig = fmt.Errorf("%w: container configuration is invalid", ErrPodStartup)
+	ErrContainerCreate = fmt.Errorf("%w: container could not be created", ErrPodStartup)
+	ErrContainerRun    = fmt.Errorf("%w: container could not be started", ErrPodStartup)
+	ErrCrashLoop       = fmt.Errorf("%w: container keeps crashing", ErrPodStartup)
+	ErrContainerExited = fmt.Errorf("%w: container exited", ErrPodStartup)
+	ErrOOMKilled       = fmt.Errorf("%w: container ran out of memory", ErrPodStartup)
+	ErrInitContainer   = fmt.Errorf("%w: init container failed", ErrPodStartup)
+	ErrUnschedulable   = fmt.Errorf("%w: pod cannot be scheduled", ErrPodStartup)
+	ErrPodDeleted      = fmt.Errorf("%w: pod was deleted", ErrPodStartup)
+)
+
+// waitingReasons maps container waiting reasons to the error they fail with.
+// Other reasons, such as ContainerCreating, are part of a normal startup.
+var waitingReasons = map[string]error{
+	"ErrImagePull":               ErrImagePull,
+	"ImagePullBackOff":           ErrImagePull,
+	"InvalidImageName":           ErrImagePull,
+	"ErrImageNeverPull":          ErrImagePull,
+	"CreateContainerConfigError": ErrContainerConfig,
+	"CreateContainerError":       ErrContainerCreate,
+	"RunContainerError":          ErrContainerRun,
+	"CrashLoopBackOff":           ErrCrashLoop,
+}
+
+// ContainerStartupError is a startup failure of a single container.
+type ContainerStartupError struct {
+	// Err is one of the startup errors above.
+	Err       error
+	Container string
+	Init      bool
+	// Step is the image of the container step the pod runs, empty for the
+	// job pod.
+	Step    string
+	Reason  string
+	Message string
+}
+
+func (e *ContainerStartupError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Err, e.Name())
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if message := strings.TrimSpace(e.Message); message != "" {
+		msg += ": " + message
+	}
+	return msg
+}
+
+func (e *ContainerStartupError) Unwrap() error {
+	return e.Err
+}
+
+// Name says which part of the workflow the container belongs to.
+func (e *ContainerStartupError) Name() string {
+	switch {
+	case e.Init:
+		return "init container " + e.Container
+	case e.Container == jobContainerName && e.Step != "":
+		return "container step " + e.Step
+	case e.Container == jobContainerName:
+		return "job container"
+	default:
+		return "service " + e.Container
+	}
+}
+
+// stepCheck makes the container startup errors of check name the container
+// step that runs image.
+func stepCheck(check podCheck, image string) podCheck {
+	return func(pod *v1.Pod, now time.Time) (bool, error) {
+		ready, err := check(pod, now)
+		var startup *ContainerStartupError
+		if errors.As(err, &startup) {
+			startup.Step = image
+		}
+		return ready, err
+	}
+}
+
+// startupFailure returns the error that pod will not start with, or nil if it
+// may still start. The job pod is pinned to the runner's node, so a pod that
+// cannot be scheduled there will not be scheduled by waiting either.
+func startupFailure(pod *v1.Pod) error {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodScheduled && cond.Status == v1.ConditionFalse && cond.Reason == v1.PodReasonUnschedulable {
+			return fmt.Errorf("%w: pod %s: %s", ErrUnschedulable, pod.Name, cond.Message)
+		}
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if err := containerFailure(status, true); err != nil {
+			return err
+		}
+		if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+			return &ContainerStartupError{
+				Err:       ErrInitContainer,
+				Container: status.Name,
+				Init:      true,
+				Reason:    fmt.Sprintf("exit code %d", t.ExitCode),
+				Message:   t.Message,
+			}
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if err := containerFailure(status, false); err != nil {
+			return err
+		}
+		if t := status.State.Terminated; t != nil {
+			// Pods are not restarted, so a container that stops before the
+			// pod is ready never comes back.
+			return &ContainerStartupError{
+				Err:       ErrContainerExited,
+				Container: status.Name,
+				Reason:    fmt.Sprintf("exit code %d", t.ExitCode),
+				Message:   t.Message,
+			}
+		}
+	}
+
+	return nil
+}
+
+// containerFailure classifies the waiting and termination reasons of a
+// container that make it fail regardless of its exit code.
+func containerFailure(status v1.ContainerStatus, init bool) error {
+	if w := status.State.Waiting; w != nil {
+		if err, ok := waitingReasons[w.Reason]; ok {
+			if err == ErrContainerRun {
+				err = runError(status, init, w.Message)
+			}
+			return &ContainerStartupError{Err: err, Container: status.Name, Init: init, Reason: w.Reason, Message: w.Message}
+		}
+	}
+
+	for _, t := range []*v1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+		if t == nil {
+			continue
+		}
+		switch t.Reason {
+		case "OOMKilled":
+			return &ContainerStartupError{Err: ErrOOMKilled, Container: status.Name, Init: init, Reason: t.Reason, Message: t.Message}
+		case "StartError", "ContainerCannotRun":
+			return &ContainerStartupError{Err: runError(status, init, t.Message), Container: status.Name, Init: init, Reason: t.Reason, Message: t.Message}
+		}
+	}
+
+	return nil
+}
+
+// runError is ErrContainerRun, which also wraps ErrMissingShell if the job
+// container could not start because its image has no tail to keep it alive.
+func runError(status v1.ContainerStatus, init bool, message string) error {
+	if !init && status.Name == jobContainerName && missingExecutable(message, "tail") {
+		return fmt.Errorf("%w: %w", ErrContainerRun, ErrMissingShell)
+	}
+	return ErrContainerRun
+}
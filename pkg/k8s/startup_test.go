@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestStartupFailure(t *testing.T) {
+	t.Parallel()
+	waiting := func(name, reason string) v1.ContainerStatus {
+		return v1.ContainerStatus{Name: name, State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason, Message: "details"}}}
+	}
+	terminated := func(name, reason string, code int32) v1.ContainerStatus {
+		return v1.ContainerStatus{Name: name, State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: reason, ExitCode: code}}}
+	}
+
+	tests := map[string]struct {
+		status  v1.PodStatus
+		wantErr error
+		wantMsg string
+	}{
+		"starting": {
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting(jobContainerName, "ContainerCreating")}},
+		},
+		"image pull error": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting(jobContainerName, "ContainerCreating"), waiting("redis", "ErrImagePull")}},
+			wantErr: ErrImagePull,
+			wantMsg: "pod failed to start: image could not be pulled: service redis: ErrImagePull: details",
+		},
+		"image pull back-off": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting(jobContainerName, "ImagePullBackOff")}},
+			wantErr: ErrImagePull,
+			wantMsg: "pod failed to start: image could not be pulled: job container: ImagePullBackOff: details",
+		},
+		"missing secret": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("postgres", "CreateContainerConfigError")}},
+			wantErr: ErrContainerConfig,
+		},
+		"create error": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("postgres", "CreateContainerError")}},
+			wantErr: ErrContainerCreate,
+		},
+		"run error": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("postgres", "RunContainerError")}},
+			wantErr: ErrContainerRun,
+		},
+		"crash loop": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{waiting("postgres", "CrashLoopBackOff")}},
+			wantErr: ErrCrashLoop,
+		},
+		"oom killed": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{terminated("postgres", "OOMKilled", 137)}},
+			wantErr: ErrOOMKilled,
+			wantMsg: "pod failed to start: container ran out of memory: service postgres: OOMKilled",
+		},
+		"oom killed before restart": {
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+				Name:                 "postgres",
+				State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			}}},
+			wantErr: ErrOOMKilled,
+		},
+		"job image without tail": {
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+				Name: jobContainerName,
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+					Reason:  "StartError",
+					Message: `failed to create containerd task: exec: "tail": executable file not found in $PATH`,
+				}},
+			}}},
+			wantErr: ErrMissingShell,
+		},
+		"service exited": {
+			status:  v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{terminated("postgres", "Error", 1)}},
+			wantErr: ErrContainerExited,
+			wantMsg: "pod failed to start: container exited: service postgres: exit code 1",
+		},
+		"init container failed": {
+			status:  v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{terminated("setup", "Error", 2)}},
+			wantErr: ErrInitContainer,
+			wantMsg: "pod failed to start: init container failed: init container setup: exit code 2",
+		},
+		"init container image": {
+			status:  v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{waiting("setup", "InvalidImageName")}},
+			wantErr: ErrImagePull,
+		},
+		"init container done": {
+			status: v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{terminated("setup", "Completed", 0)}},
+		},
+		"unschedulable": {
+			status: v1.PodStatus{Conditions: []v1.PodCondition{{
+				Type:    v1.PodScheduled,
+				Status:  v1.ConditionFalse,
+				Reason:  v1.PodReasonUnschedulable,
+				Message: "0/1 nodes are available: 1 Insufficient memory.",
+			}}},
+			wantErr: ErrUnschedulable,
+			wantMsg: "pod failed to start: pod cannot be scheduled: pod job-pod: 0/1 nodes are available: 1 Insufficient memory.",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pod := &v1.Pod{Status: tt.status}
+			pod.Name = "job-pod"
+			err := startupFailure(pod)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("startupFailure() unexpected error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrPodStartup) {
+				t.Fatalf("startupFailure() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("startupFailure() error = %q, want %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8sExec "k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+// ErrStepFailed is the cause of the exit error of a step that ran as the main
+// process of its pod and exited non-zero.
+var ErrStepFailed = errors.New("step exited with non-zero exit code")
+
+// stepCommand returns the container command and arguments that run the
+// entrypoint of a container step directly, escaped like env values.
+func stepCommand(cont types.ContainerDefinition) ([]string, []string) {
+	if len(cont.PrependPath) > 0 {
+		slog.Warn("Container steps that run directly cannot prepend to PATH", "prependPath", cont.PrependPath)
+	}
+
+	args := make([]string, 0, len(cont.EntrypointArgs))
+	for _, arg := range cont.EntrypointArgs {
+		args = append(args, escapeExpansion(arg))
+	}
+	return []string{escapeExpansion(cont.Entrypoint)}, args
+}
+
+// escapeExpansion escapes every $ in s. Kubernetes expands $(VAR) and $$ in
+// container commands, arguments and env values, which docker does not, so
+// values such as secrets would otherwise change.
+func escapeExpansion(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// containerEnv returns env as container env vars, sorted by name and escaped,
+// so the values reach the container unchanged whatever their order.
+func containerEnv(env map[string]string) []v1.EnvVar {
+	vars := make([]v1.EnvVar, 0, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		vars = append(vars, v1.EnvVar{Name: name, Value: escapeExpansion(env[name])})
+	}
+	return vars
+}
+
+// FollowStepPod streams the logs of a step pod that runs the step as its main
+// process and waits for the step to finish. Like ExecInPod, the error is a
+// k8sExec.ExitError if the step exited non-zero; its message includes the
+// termination message of the container.
+func (c *K8sClient) FollowStepPod(ctx context.Context, name string) error {
+	logs, err := c.client.CoreV1().Pods(c.GetNS()).GetLogs(name, &v1.PodLogOptions{
+		Container: jobContainerName,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		slog.Warn("Failed to stream step logs", "pod", name, "err", err)
+	} else {
+		if _, err := io.Copy(os.Stdout, logs); err != nil {
+			slog.Warn("Step log stream broke", "pod", name, "err", err)
+		}
+		_ = logs.Close()
+	}
+
+	var state *v1.ContainerStateTerminated
+	err = c.watchPod(ctx, name, "", func(pod *v1.Pod, _ time.Time) (bool, error) {
+		status := jobContainerStatus(pod)
+		if status == nil || status.State.Terminated == nil {
+			return false, nil
+		}
+		if err := containerFailure(*status, false); err != nil {
+			return false, err
+		}
+		state = status.State.Terminated
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrExec, name, err)
+	}
+
+	message := strings.TrimSpace(state.Message)
+	if message != "" {
+		slog.Info("Step termination message", "pod", name, "message", message)
+	}
+	if state.ExitCode == 0 {
+		return nil
+	}
+	if message == "" {
+		message = state.Reason
+	}
+	return k8sExec.CodeExitError{
+		Err:  fmt.Errorf("%w %d: %s", ErrStepFailed, state.ExitCode, message),
+		Code: int(state.ExitCode),
+	}
+}
+
+// stepStarted reports whether the job container of a step pod that runs the
+// step directly has started, or why it will not. A step may finish before the
+// pod could be ready, so unlike podReady it does not wait for readiness.
+func stepStarted(pod *v1.Pod, _ time.Time) (bool, error) {
+	if status := jobContainerStatus(pod); status != nil {
+		if err := containerFailure(*status, false); err != nil {
+			return false, err
+		}
+		if status.State.Running != nil || status.State.Terminated != nil {
+			return true, nil
+		}
+	}
+
+	return false, startupFailure(pod)
+}
+
+func jobContainerStatus(pod *v1.Pod) *v1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == jobContainerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package k8s
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sExec "k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestStepCommand(t *testing.T) {
+	t.Parallel()
+	command, args := stepCommand(types.ContainerDefinition{
+		Entrypoint:     "/bin/$(NAME)",
+		EntrypointArgs: []string{"--greeting", "hello $(USER)", "$$HOME"},
+	})
+
+	if want := []string{"/bin/$$(NAME)"}; !slices.Equal(command, want) {
+		t.Errorf("stepCommand() command = %q, want %q", command, want)
+	}
+	if want := []string{"--greeting", "hello $$(USER)", "$$$$HOME"}; !slices.Equal(args, want) {
+		t.Errorf("stepCommand() args = %q, want %q", args, want)
+	}
+}
+
+func TestContainerEnv(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{"TOKEN": "pa$(USER)s$$word", "GREETING": "hello", "API_KEY": "$"}
+
+	want := []v1.EnvVar{
+		{Name: "API_KEY", Value: "$$"},
+		{Name: "GREETING", Value: "hello"},
+		{Name: "TOKEN", Value: "pa$$(USER)s$$$$word"},
+	}
+	for range 10 {
+		if got := containerEnv(env); !slices.Equal(got, want) {
+			t.Fatalf("containerEnv() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestStepStarted(t *testing.T) {
+	t.Parallel()
+	job := func(state v1.ContainerState) v1.PodStatus {
+		return v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{Name: jobContainerName, State: state}}}
+	}
+
+	tests := map[string]struct {
+		status  v1.PodStatus
+		want    bool
+		wantErr error
+	}{
+		"pending": {
+			status: v1.PodStatus{Phase: v1.PodPending},
+		},
+		"creating": {
+			status: job(v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}),
+		},
+		"running": {
+			status: job(v1.ContainerState{Running: &v1.ContainerStateRunning{}}),
+			want:   true,
+		},
+		"already finished": {
+			status: job(v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1}}),
+			want:   true,
+		},
+		"entrypoint not found": {
+			status:  job(v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 128, Reason: "StartError"}}),
+			wantErr: ErrContainerRun,
+		},
+		"image pull error": {
+			status:  job(v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ErrImagePull"}}),
+			wantErr: ErrImagePull,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := stepStarted(&v1.Pod{Status: tt.status}, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("stepStarted() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("stepStarted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowStepPod(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		state    v1.ContainerStateTerminated
+		wantCode int
+		wantErr  error
+		wantMsg  string
+	}{
+		"success": {
+			state: v1.ContainerStateTerminated{Reason: "Completed"},
+		},
+		"failure": {
+			state:    v1.ContainerStateTerminated{ExitCode: 3, Reason: "Error", Message: "lint failed"},
+			wantCode: 3,
+			wantMsg:  "step exited with non-zero exit code 3: lint failed",
+		},
+		"oom killed": {
+			state:   v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+			wantErr: ErrOOMKilled,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pod := &v1.Pod{
+				ObjectMeta: v1Meta.ObjectMeta{Name: "step-pod", Namespace: "default"},
+				Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+					Name:  jobContainerName,
+					State: v1.ContainerState{Terminated: &tt.state},
+				}}},
+			}
+			c := K8sClient{client: fake.NewClientset(pod), cfg: testConfig()}
+
+			err := c.FollowStepPod(t.Context(), "step-pod")
+			if tt.wantCode == 0 && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FollowStepPod() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && (err == nil || err.Error() != tt.wantMsg) {
+				t.Errorf("FollowStepPod() error = %v, want %q", err, tt.wantMsg)
+			}
+			var exitErr k8sExec.ExitError
+			if errors.As(err, &exitErr) != (tt.wantCode != 0) || (tt.wantCode != 0 && exitErr.ExitStatus() != tt.wantCode) {
+				t.Errorf("FollowStepPod() error = %v, want exit code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
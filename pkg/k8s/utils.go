@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"math/rand"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,24 +25,23 @@ var (
 	ErrValidation = errors.New("validation error")
 )
 
-func (c *K8sClient) GetNS() string {
-	namespace := os.Getenv("ACTIONS_RUNNER_KUBERNETES_NAMESPACE")
-	if namespace != "" {
-		return namespace
-	}
+// cleanupTimeout bounds how long cleanup may take, including waiting for
+// pods to terminate, once the hook is cancelled.
+const cleanupTimeout = 2 * time.Minute
 
-	namespaceBytes, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		slog.Warn("Failed to read namespace from ACTIONS_RUNNER_KUBERNETES_NAMESPACE or service account, defaulting to 'default'", "error", err)
-	} else {
-		return strings.TrimSpace(string(namespaceBytes))
-	}
+// CleanupContext returns a context for deleting resources that is not
+// cancelled together with ctx, so cleanup still runs after the runner
+// cancels the job, but is bounded so the hook cannot hang on exit.
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
 
-	return "default"
+func (c *K8sClient) GetNS() string {
+	return c.cfg.Namespace
 }
 
-func (c *K8sClient) GetPodNodeName(mname string) (string, error) {
-	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(c.ctx, mname, v1Meta.GetOptions{})
+func (c *K8sClient) GetPodNodeName(ctx context.Context, mname string) (string, error) {
+	pod, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, mname, v1Meta.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -49,42 +50,54 @@ func (c *K8sClient) GetPodNodeName(mname string) (string, error) {
 }
 
 func (c *K8sClient) GetRunnerPodName() string {
-	name := os.Getenv("ACTIONS_RUNNER_POD_NAME")
-	if name == "" {
-		name = "local-pod"
-	}
-	return name
+	return c.cfg.RunnerPodName
 }
 
-func (c *K8sClient) GetVolumeClaimName() string {
-	name := os.Getenv("ACTIONS_RUNNER_CLAIM_NAME")
-	if name == "" {
-		return c.GetRunnerPodName() + "-work"
+// ownerReferences makes the runner pod the owner of the objects the hook
+// creates, so Kubernetes deletes them together with the runner. The runner
+// pod is looked up once; if it cannot be found, objects get no owner.
+func (c *K8sClient) ownerReferences(ctx context.Context) []v1Meta.OwnerReference {
+	if c.cfg.DisableOwnerReferences {
+		return nil
+	}
+	if c.owner == nil {
+		c.owner = []v1Meta.OwnerReference{}
+		runner, err := c.client.CoreV1().Pods(c.GetNS()).Get(ctx, c.GetRunnerPodName(), v1Meta.GetOptions{})
+		if err != nil {
+			slog.Warn("Failed to look up runner pod, created objects will not be deleted with it", "pod", c.GetRunnerPodName(), "err", err)
+			return nil
+		}
+		c.owner = []v1Meta.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       runner.Name,
+			UID:        runner.UID,
+		}}
+	}
+	if len(c.owner) == 0 {
+		return nil
 	}
 
-	return name
+	return c.owner
 }
 
-func (c *K8sClient) checkPermissions() {
-	// FIXME: Implement permission checks
-	slog.Warn("TODO: Implement permission check for creating pods")
+func (c *K8sClient) GetVolumeClaimName() string {
+	return c.cfg.VolumeClaimName()
+}
+
+// CheckVolumeClaim verifies that the work volume claim exists.
+func (c *K8sClient) CheckVolumeClaim(ctx context.Context) error {
+	_, err := c.client.CoreV1().PersistentVolumeClaims(c.GetNS()).Get(ctx, c.GetVolumeClaimName(), v1Meta.GetOptions{})
+	return err
 }
 
 // writeRunScript generates a shell script that sets up the environment and runs the specified entrypoint with its arguments.
 // returns the path to the script in the container and the local path of the script file, or error if any.
 func (c *K8sClient) writeRunScript(args types.InputArgs) (string, string, error) {
-	prependPath := strings.Join(args.PrependPath, ":")
-	cl := strings.Join(append([]string{args.Entrypoint}, args.EntrypointArgs...), " ")
-	scriptEnv, err := scriptEnvironment(args.EnvironmentVariables)
+	script, err := runScript(args)
 	if err != nil {
 		return "", "", err
 	}
-	script := fmt.Sprintf(`
-	#!/bin/sh -l
-	set -e
-	export PATH=%s:$PATH
-	cd %s && exec %s %s
-  `, prependPath, args.WorkingDirectory, scriptEnv, cl)
 	f, err := os.CreateTemp(os.Getenv("RUNNER_TEMP"), "run-script-*.sh")
 	if err != nil {
 		return "", "", err
@@ -162,23 +175,6 @@ func copyFile(src, dst string, mode os.FileMode) error {
 	return os.Chmod(dst, mode) // #nosec G703 -- dst is derived from a Walk over operator-supplied RUNNER_WORKSPACE; path traversal is not a meaningful threat here
 }
 
-func getPrepareJobTimeout() int {
-	const defaultTimeout = 600
-	t, ok := os.LookupEnv("ACTIONS_RUNNER_PREPARE_JOB_TIMEOUT_SECONDS")
-	if ok {
-		convTimeout, convErr := strconv.Atoi(t)
-		if convErr != nil {
-			slog.Info("Invalid timeout value, using default of 600 seconds")
-			return defaultTimeout
-		}
-
-		return convTimeout
-	}
-
-	slog.Info("Using default timeout of 600 seconds for preparing job pod")
-	return defaultTimeout
-}
-
 // parsePort parses a port string to int32
 func parsePort(portStr string) (int32, error) {
 	var port int
@@ -201,59 +197,87 @@ func podPostfix() string {
 	return string(post)
 }
 
-func podEventHandler(cancel context.CancelFunc, errPtr *error) func(oldObj, newObj any) {
-	return func(oldObj, newObj any) {
-		pod, ok := newObj.(*v1.Pod)
-		if !ok {
-			slog.Error("Received non-pod object in UpdateFunc")
-			return
-		}
+// podCheckInterval is how often a pod's readiness is re-evaluated while
+// waiting, and how often it is read when it cannot be watched.
+const podCheckInterval = 5 * time.Second
 
-		slog.Debug("Pod status changed", "pod", pod.Name, "status", pod.Status.Phase)
-		for _, c := range pod.Status.ContainerStatuses {
-			slog.Debug("Container state", "name", c.Name, "state", c.State)
-			if c.State.Waiting != nil {
-				switch c.State.Waiting.Reason {
-				case "InvalidImageName":
-					slog.Error("Invalid Image Name Specified", "pod", pod.Name, "reason", c.State.Waiting.Reason, "message", c.State.Waiting.Message)
-					*errPtr = fmt.Errorf("%w: failed to pull image: %s", ErrPodStartup, c.State.Waiting.Message)
-					cancel()
-				case "ImagePullBackOff":
-					slog.Error("Runner failed to pull image", "pod", pod.Name, "reason", c.State.Waiting.Reason, "message", c.State.Waiting.Message)
-					*errPtr = fmt.Errorf("%w: failed to pull image: %s", ErrPodStartup, c.State.Waiting.Message)
-					cancel()
-				case "CrashLoopBackOff":
-					slog.Error("Runner image crashing on startup", "pod", pod.Name, "reason", c.State.Waiting.Reason, "message", c.State.Waiting.Message)
-					*errPtr = fmt.Errorf("%w: image crashing on startup: %s", ErrPodStartup, c.State.Waiting.Message)
-					cancel()
-				}
-			}
+// podReady reports whether all containers of pod are ready, or why it will
+// not get ready.
+func podReady(pod *v1.Pod, now time.Time) (bool, error) {
+	slog.Debug("Pod status changed", "pod", pod.Name, "status", pod.Status.Phase)
+	for _, c := range pod.Status.ContainerStatuses {
+		slog.Debug("Container state", "name", c.Name, "state", c.State)
+	}
+	if err := startupFailure(pod); err != nil {
+		slog.Error("Pod failed to start", "pod", pod.Name, "err", err)
+		return false, err
+	}
+	switch pod.Status.Phase {
+	case v1.PodFailed, v1.PodSucceeded:
+		return false, fmt.Errorf("%w: pod %s", ErrPodStartup, strings.ToLower(string(pod.Status.Phase)))
+	case v1.PodRunning:
+		// Wait for readiness probes, which come from service health checks.
+		ready, unhealthy := containerHealth(pod, now)
+		if len(unhealthy) > 0 {
+			slog.Error("Containers did not become healthy", "pod", pod.Name, "containers", unhealthy)
+			return false, &ServiceUnhealthyError{Containers: unhealthy}
 		}
-		if pod.Status.Phase == v1.PodRunning || pod.Status.Phase == v1.PodFailed {
-			if pod.Status.Phase == v1.PodFailed {
-				*errPtr = fmt.Errorf("%w: pod failed", ErrPodStartup)
-			}
-			cancel()
+		return ready, nil
+	}
+	return false, nil
+}
+
+// runScript returns a POSIX shell script that prepends to PATH, changes to the
+// working directory and runs the entrypoint with its arguments and
+// environment. Every value from the input is quoted, so it reaches the
+// entrypoint unchanged.
+func runScript(args types.InputArgs) (string, error) {
+	scriptEnv, err := scriptEnvironment(args.EnvironmentVariables)
+	if err != nil {
+		return "", err
+	}
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh -l\nset -e\n")
+	if len(args.PrependPath) > 0 {
+		paths := make([]string, 0, len(args.PrependPath))
+		for _, p := range args.PrependPath {
+			paths = append(paths, shellQuote(p))
 		}
+		fmt.Fprintf(&script, "export PATH=%s:\"$PATH\"\n", strings.Join(paths, ":"))
+	}
+	if args.WorkingDirectory != "" {
+		fmt.Fprintf(&script, "cd -- %s\n", shellQuote(args.WorkingDirectory))
 	}
+	command := make([]string, 0, len(args.EntrypointArgs)+1)
+	for _, arg := range append([]string{args.Entrypoint}, args.EntrypointArgs...) {
+		command = append(command, shellQuote(arg))
+	}
+	fmt.Fprintf(&script, "exec %s %s\n", scriptEnv, strings.Join(command, " "))
+
+	return script.String(), nil
 }
 
+// scriptEnvironment returns an env command that sets the variables of env in
+// a stable order.
 func scriptEnvironment(env map[string]string) (string, error) {
 	var envstr strings.Builder
 	envstr.WriteString("env")
-	for k, v := range env {
-		if strings.ContainsAny(k, `"'=$`) {
-			return "", fmt.Errorf("%w: invalid character [\"'=$] in environment variable key: %s", ErrValidation, k)
-		}
-		v = strings.ReplaceAll(v, `\`, `\\`)
-		v = strings.ReplaceAll(v, `"`, `\"`)
-		v = strings.ReplaceAll(v, `$`, `\$`)
-		v = strings.ReplaceAll(v, "`", "\\`")
-		_, err := fmt.Fprintf(&envstr, ` "%s=%s"`, k, v)
-		if err != nil {
-			return "", err
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		if k == "" || strings.ContainsAny(k, `"'=$`) {
+			return "", fmt.Errorf("%w: invalid character [\"'=$] in environment variable key: %q", ErrValidation, k)
 		}
+		envstr.WriteString(" " + shellQuote(k+"="+env[k]))
 	}
 
 	return envstr.String(), nil
 }
+
+// shellQuote quotes s as a single word for POSIX shells. Words made only of
+// characters that no shell treats specially are left as they are.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
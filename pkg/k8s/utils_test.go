@@ -2,10 +2,18 @@ package k8s
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
+	v1 "k8s.io/api/core/v1"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
 	"github.com/reMarkable/k8s-hook/pkg/types"
 )
 
@@ -82,17 +90,110 @@ func TestWriteRunScript(t *testing.T) {
 		t.Fatalf("Failed to read script file: %v", err)
 	}
 	content := string(data)
-	if !strings.Contains(content, "#!/bin/sh -l") {
-		t.Errorf("Script missing shebang")
+	if !strings.HasPrefix(content, "#!/bin/sh -l\n") {
+		t.Errorf("Script does not start with shebang")
 	}
-	if !strings.Contains(content, "export PATH=/usr/local/bin:/custom/bin:$PATH") {
+	if !strings.Contains(content, `export PATH=/usr/local/bin:/custom/bin:"$PATH"`) {
 		t.Errorf("Script missing correct PATH export")
 	}
-	if !strings.Contains(content, `env "FOO=bar"`) {
-		t.Errorf("Script missing environment variables")
+	if !strings.Contains(content, "cd -- /tmp\n") {
+		t.Errorf("Script missing cd command")
+	}
+	if !strings.Contains(content, `exec env FOO=bar bash -c 'echo hello'`) {
+		t.Errorf("Script missing exec command with environment variables")
+	}
+}
+
+func TestRunScriptQuoting(t *testing.T) {
+	t.Parallel()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the script with")
+	}
+	// The entrypoint prints what it got, one value per line.
+	report := []string{"-c", `printf '%s\n' "$PWD" "$FOO" "${PATH%%:*}" "$@"`, "sh"}
+
+	tests := map[string]struct {
+		args []string
+		env  string
+		dir  string
+		path string
+	}{
+		"plain": {
+			args: []string{"hello"},
+			env:  "bar",
+			dir:  "work",
+			path: "bin",
+		},
+		"spaces and quotes": {
+			args: []string{"two words", `"double"`, "it's", `back\slash`},
+			env:  `it's "quoted"`,
+			dir:  "my dir",
+			path: "my bin",
+		},
+		"expansions": {
+			args: []string{"$HOME", "${PATH}", "$(id -u)", "`id -u`", "$((1+1))", "~"},
+			env:  "$(touch pwned)",
+			dir:  "$(touch pwned)",
+			path: "$HOME",
+		},
+		"globs": {
+			args: []string{"*", "?", "[a-z]*", "{a,b}"},
+			env:  "*",
+			dir:  "[dir]",
+			path: "*",
+		},
+		"control characters": {
+			args: []string{"semi;colon", "a && b", "pipe|", "redirect > out", "new\nline", "tab\there", "#comment"},
+			env:  "x; touch pwned",
+			dir:  "a;b",
+			path: "a&b",
+		},
+		"leading dash and empty": {
+			args: []string{"-n", "--", "", "-"},
+			env:  "",
+			dir:  "-dir",
+			path: "-bin",
+		},
 	}
-	if !strings.Contains(content, "cd /tmp && exec") {
-		t.Errorf("Script missing cd and exec command")
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			root := t.TempDir()
+			dir := filepath.Join(root, tt.dir)
+			path := filepath.Join(root, tt.path)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatalf("Failed to create working directory: %v", err)
+			}
+
+			script, err := runScript(types.InputArgs{ContainerDefinition: types.ContainerDefinition{
+				PrependPath:          []string{path, "/usr/bin"},
+				Entrypoint:           sh,
+				EntrypointArgs:       append(slices.Clone(report), tt.args...),
+				EnvironmentVariables: map[string]string{"FOO": tt.env},
+				WorkingDirectory:     dir,
+			}})
+			if err != nil {
+				t.Fatalf("runScript() unexpected error = %v", err)
+			}
+			scriptPath := filepath.Join(root, "run.sh")
+			if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+				t.Fatalf("Failed to write script: %v", err)
+			}
+
+			out, err := exec.CommandContext(t.Context(), sh, "-e", scriptPath).Output() // #nosec G204 -- test runs the script it generated
+			if err != nil {
+				t.Fatalf("script failed: %v\n%s", err, script)
+			}
+			want := append([]string{dir, tt.env, path}, tt.args...)
+			if got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); !slices.Equal(got, strings.Split(strings.Join(want, "\n"), "\n")) {
+				t.Errorf("entrypoint got %q, want %q\n%s", got, want, script)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+				t.Errorf("script ran a command substitution\n%s", script)
+			}
+		})
 	}
 }
 
@@ -106,8 +207,8 @@ func TestScriptEnvironment(t *testing.T) {
 	if err != nil {
 		t.Fatalf("scriptEnvironment returned error: %v", err)
 	}
-	wantPrefix := `env "FOO=bar\"baz\$qux\\test" "BAR=simple"`
-	if got != wantPrefix && got != `env "BAR=simple" "FOO=bar\"baz\$qux\\test"` {
+	wantPrefix := `env BAR=simple 'FOO=bar"baz$qux\test'`
+	if got != wantPrefix {
 		t.Errorf("scriptEnvironment output mismatch:\ngot:  %s\nwant: %s", got, wantPrefix)
 	}
 
@@ -219,3 +320,57 @@ func TestCopyDir(t *testing.T) {
 		t.Errorf("Nested file content mismatch: got %q, want %q", string(data), string(nestedContent))
 	}
 }
+
+func TestOwnerReferences(t *testing.T) {
+	t.Parallel()
+	runner := &v1.Pod{ObjectMeta: v1Meta.ObjectMeta{Name: "test-runner", Namespace: "default", UID: k8sTypes.UID("1234")}}
+	owner := []v1Meta.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "test-runner", UID: "1234"}}
+	tests := map[string]struct {
+		runner  *v1.Pod
+		disable bool
+		want    []v1Meta.OwnerReference
+	}{
+		"runner pod": {
+			runner: runner,
+			want:   owner,
+		},
+		"runner is not a pod": {},
+		"disabled": {
+			runner:  runner,
+			disable: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := K8sClient{client: fake.NewClientset(), cfg: testConfig()}
+			c.cfg.DisableOwnerReferences = tt.disable
+			if tt.runner != nil {
+				if _, err := c.client.CoreV1().Pods("default").Create(t.Context(), tt.runner, v1Meta.CreateOptions{}); err != nil {
+					t.Fatalf("Failed to create runner pod: %v", err)
+				}
+			}
+
+			pod, err := c.preparePodSpec(t.Context(), types.ContainerDefinition{Image: "node:20"}, nil, PodTypeJob)
+			if err != nil {
+				t.Fatalf("preparePodSpec() unexpected error = %v", err)
+			}
+			secretName, err := c.applyPullSecret(t.Context(), &dockerConfig{Auths: map[string]registryAuth{"ghcr.io": {Username: "user", Password: "secret"}}}, false)
+			if err != nil {
+				t.Fatalf("applyPullSecret() unexpected error = %v", err)
+			}
+			secret, err := c.client.CoreV1().Secrets("default").Get(t.Context(), secretName, v1Meta.GetOptions{})
+			if err != nil {
+				t.Fatalf("Failed to get secret: %v", err)
+			}
+
+			if !reflect.DeepEqual(pod.OwnerReferences, tt.want) {
+				t.Errorf("pod owner references = %+v, want %+v", pod.OwnerReferences, tt.want)
+			}
+			if !reflect.DeepEqual(secret.OwnerReferences, tt.want) {
+				t.Errorf("secret owner references = %+v, want %+v", secret.OwnerReferences, tt.want)
+			}
+		})
+	}
+}
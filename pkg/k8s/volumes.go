@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var ErrUnsupportedVolume = errors.New("unsupported container volume")
+
+// defaultWorkDir is the runner work directory of the runner image, used when
+// RUNNER_WORKSPACE is not set.
+const defaultWorkDir = "/home/runner/_work"
+
+// Volumes the hook adds are named with these prefixes and a number that no
+// other volume of the pod uses.
+const (
+	anonVolumePrefix  = "anon"
+	tmpfsVolumePrefix = "tmpfs"
+)
+
+// addContainerVolumes mounts the volumes the runner asks for into container.
+//
+// Host paths inside workDir, the runner work directory, become subPath mounts
+// on the work volume, anonymous volumes become emptyDirs, and named volumes must be
+// defined in the pod template. System volumes that the hook already mounts,
+// or that cannot exist in Kubernetes such as the docker socket, are skipped;
+// user volumes that cannot be mounted are an error.
+func addContainerVolumes(pod *v1.Pod, container *v1.Container, workDir string, system, user []types.MountVolume) error {
+	for _, vol := range system {
+		if isMounted(container, vol.TargetVolumePath) {
+			continue
+		}
+		mount, err := volumeMount(pod, workDir, vol)
+		if err != nil {
+			slog.Debug("Skipping system volume", "container", container.Name, "target", vol.TargetVolumePath, "err", err)
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+	}
+
+	for _, vol := range user {
+		if isMounted(container, vol.TargetVolumePath) {
+			return fmt.Errorf("%w: %s in container %s: the hook already mounts this path", ErrUnsupportedVolume, vol.TargetVolumePath, container.Name)
+		}
+		mount, err := volumeMount(pod, workDir, vol)
+		if err != nil {
+			return fmt.Errorf("%w in container %s", err, container.Name)
+		}
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+	}
+
+	return nil
+}
+
+// volumeMount resolves a runner volume to a mount, adding an emptyDir to the
+// pod for anonymous volumes.
+func volumeMount(pod *v1.Pod, workDir string, vol types.MountVolume) (v1.VolumeMount, error) {
+	target := vol.TargetVolumePath
+	if !path.IsAbs(target) {
+		return v1.VolumeMount{}, fmt.Errorf("%w: target %q is not an absolute path", ErrUnsupportedVolume, target)
+	}
+	mount := v1.VolumeMount{MountPath: path.Clean(target), ReadOnly: vol.ReadOnly}
+	source := vol.SourceVolumePath
+
+	switch {
+	case source == "":
+		mount.Name = newVolumeName(pod.Spec.Volumes, anonVolumePrefix)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name:         mount.Name,
+			VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+		})
+	case path.IsAbs(source):
+		subPath, ok := workSubPath(workDir, source)
+		if !ok {
+			return v1.VolumeMount{}, fmt.Errorf("%w: host path %s is outside the runner work directory", ErrUnsupportedVolume, source)
+		}
+		mount.Name = JobVolumeName
+		mount.SubPath = subPath
+	default:
+		if !hasVolume(pod, source) {
+			return v1.VolumeMount{}, fmt.Errorf("%w: named volume %q is not defined in the pod template", ErrUnsupportedVolume, source)
+		}
+		mount.Name = source
+	}
+
+	return mount, nil
+}
+
+// runnerWorkDir returns the runner work directory, the root of the work
+// volume, which is the parent of RUNNER_WORKSPACE.
+func runnerWorkDir() string {
+	if workspace := os.Getenv("RUNNER_WORKSPACE"); workspace != "" {
+		return path.Dir(path.Clean(workspace))
+	}
+	return defaultWorkDir
+}
+
+// workSubPath returns the path of hostPath relative to workDir, and whether
+// hostPath is inside it.
+func workSubPath(workDir, hostPath string) (string, bool) {
+	workDir, hostPath = path.Clean(workDir), path.Clean(hostPath)
+	if hostPath == workDir {
+		return "", true
+	}
+	subPath, ok := strings.CutPrefix(hostPath, strings.TrimSuffix(workDir, "/")+"/")
+	if !ok {
+		return "", false
+	}
+
+	return subPath, true
+}
+
+// isMounted reports whether target is at or below a path already mounted in container.
+func isMounted(container *v1.Container, target string) bool {
+	target = path.Clean(target)
+	for _, m := range container.VolumeMounts {
+		if target == m.MountPath || strings.HasPrefix(target, strings.TrimSuffix(m.MountPath, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasVolume(pod *v1.Pod, name string) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newVolumeName returns the first name of the form prefix-N that none of
+// volumes has.
+func newVolumeName(volumes []v1.Volume, prefix string) string {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%d", prefix, i)
+		if !slices.ContainsFunc(volumes, func(vol v1.Volume) bool { return vol.Name == name }) {
+			return name
+		}
+	}
+}
+
+// renameVolume renames a volume of pod and the mounts of it.
+func renameVolume(pod *v1.Pod, from, to string) {
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == from {
+			pod.Spec.Volumes[i].Name = to
+		}
+	}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			for j := range containers[i].VolumeMounts {
+				if containers[i].VolumeMounts[j].Name == from {
+					containers[i].VolumeMounts[j].Name = to
+				}
+			}
+		}
+	}
+}
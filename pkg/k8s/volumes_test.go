@@ -0,0 +1,120 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+func TestAddContainerVolumes(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		// volumes are defined by the pod template, in addition to the work
+		// volume and "shared".
+		volumes    []string
+		system     []types.MountVolume
+		user       []types.MountVolume
+		wantMounts []v1.VolumeMount
+		wantErr    error
+	}{
+		"work directory path": {
+			user: []types.MountVolume{
+				{SourceVolumePath: "/home/runner/_work/repo/repo/data", TargetVolumePath: "/data", ReadOnly: true},
+			},
+			wantMounts: []v1.VolumeMount{{Name: JobVolumeName, MountPath: "/data", SubPath: "repo/repo/data", ReadOnly: true}},
+		},
+		"whole work directory": {
+			user:       []types.MountVolume{{SourceVolumePath: "/home/runner/_work", TargetVolumePath: "/work"}},
+			wantMounts: []v1.VolumeMount{{Name: JobVolumeName, MountPath: "/work"}},
+		},
+		"anonymous volume": {
+			user:       []types.MountVolume{{TargetVolumePath: "/cache"}},
+			wantMounts: []v1.VolumeMount{{Name: "anon-0", MountPath: "/cache"}},
+		},
+		"anonymous volumes next to template volumes": {
+			volumes:    []string{"anon-0", "volume-2"},
+			user:       []types.MountVolume{{TargetVolumePath: "/cache"}, {TargetVolumePath: "/data"}},
+			wantMounts: []v1.VolumeMount{{Name: "anon-1", MountPath: "/cache"}, {Name: "anon-2", MountPath: "/data"}},
+		},
+		"named volume from template": {
+			user:       []types.MountVolume{{SourceVolumePath: "shared", TargetVolumePath: "/shared"}},
+			wantMounts: []v1.VolumeMount{{Name: "shared", MountPath: "/shared"}},
+		},
+		"unknown named volume": {
+			user:    []types.MountVolume{{SourceVolumePath: "missing", TargetVolumePath: "/missing"}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"work directory nested in the work directory": {
+			user:       []types.MountVolume{{SourceVolumePath: "/home/runner/_work/repo/repo/_work/data", TargetVolumePath: "/data"}},
+			wantMounts: []v1.VolumeMount{{Name: JobVolumeName, MountPath: "/data", SubPath: "repo/repo/_work/data"}},
+		},
+		"work directory of another path": {
+			user:    []types.MountVolume{{SourceVolumePath: "/etc/_work/x", TargetVolumePath: "/x"}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"host path outside work directory": {
+			user:    []types.MountVolume{{SourceVolumePath: "/etc", TargetVolumePath: "/host-etc"}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"escaping the work directory": {
+			user:    []types.MountVolume{{SourceVolumePath: "/home/runner/_work/../secrets", TargetVolumePath: "/secrets"}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"relative target": {
+			user:    []types.MountVolume{{SourceVolumePath: "/home/runner/_work/data", TargetVolumePath: "data"}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"target already mounted": {
+			user:    []types.MountVolume{{SourceVolumePath: "/home/runner/_work/x", TargetVolumePath: mountPathWorkDir}},
+			wantErr: ErrUnsupportedVolume,
+		},
+		"system volumes already mounted or unavailable are skipped": {
+			system: []types.MountVolume{
+				{SourceVolumePath: "/var/run/docker.sock", TargetVolumePath: "/var/run/docker.sock"},
+				{SourceVolumePath: "/home/runner/_work/_temp", TargetVolumePath: "/__w/_temp"},
+				{SourceVolumePath: "/home/runner/_work/_tool", TargetVolumePath: "/opt/tools"},
+			},
+			wantMounts: []v1.VolumeMount{{Name: JobVolumeName, MountPath: "/opt/tools", SubPath: "_tool"}},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pod := &v1.Pod{Spec: v1.PodSpec{Volumes: []v1.Volume{{Name: JobVolumeName}, {Name: "shared"}}}}
+			for _, name := range tt.volumes {
+				pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{Name: name})
+			}
+			container := &v1.Container{Name: jobContainerName, VolumeMounts: []v1.VolumeMount{{Name: JobVolumeName, MountPath: mountPathWorkDir}}}
+
+			err := addContainerVolumes(pod, container, "/home/runner/_work", tt.system, tt.user)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("addContainerVolumes() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("addContainerVolumes() unexpected error = %v", err)
+			}
+
+			got := container.VolumeMounts[1:]
+			if len(got) != len(tt.wantMounts) {
+				t.Fatalf("addContainerVolumes() mounts = %+v, want %+v", got, tt.wantMounts)
+			}
+			for i, want := range tt.wantMounts {
+				if got[i] != want {
+					t.Errorf("addContainerVolumes() mount[%d] = %+v, want %+v", i, got[i], want)
+				}
+			}
+			for _, mount := range got {
+				if !hasVolume(pod, mount.Name) {
+					t.Errorf("addContainerVolumes() mount %s has no pod volume", mount.Name)
+				}
+			}
+		})
+	}
+}
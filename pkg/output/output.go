@@ -0,0 +1,187 @@
+// Package output writes GitHub Actions workflow commands, so hook failures show
+// up as annotations at the top of the job log instead of only as log lines.
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/validation"
+)
+
+const defaultTitle = "Container hook failed"
+
+// Detailer is implemented by errors that carry long diagnostics, such as pod
+// events, which are written to a collapsed group below the annotation.
+type Detailer interface {
+	Details() string
+}
+
+type hint struct {
+	target      error
+	title       string
+	remediation string
+}
+
+// hints are matched in order with errors.Is, so more specific errors go first.
+var hints = []hint{
+	{
+		target:      k8s.ErrMissingPermissions,
+		title:       "Missing Kubernetes permissions",
+		remediation: "Grant the runner service account the listed permissions. Run `actions-k8shook doctor` in the runner pod to verify.",
+	},
+	{
+		target:      k8s.ErrPodTimeout,
+		title:       "Timed out waiting for pod",
+		remediation: "Check that the cluster has capacity for the job pod, or raise prepareJobTimeoutSeconds for slow image pulls.",
+	},
+	{
+		target:      k8s.ErrServiceUnhealthy,
+		title:       "Service did not become healthy",
+		remediation: "Check the service's health check and its logs below. Raise --health-retries or --health-start-period in `options:` for services that are slow to start.",
+	},
+	{
+		target:      k8s.ErrMissingShell,
+		title:       "Job image has no shell",
+		remediation: "The hook keeps job containers running with `tail` and runs steps with `sh`. Use an image that has both, or set shellHelperImage to a static busybox image, e.g. busybox:musl, to inject them.",
+	},
+	{
+		target:      k8s.ErrImagePull,
+		title:       "Image could not be pulled",
+		remediation: "Check that the image name and tag are correct and that the registry credentials in the workflow can pull it.",
+	},
+	{
+		target:      k8s.ErrContainerConfig,
+		title:       "Invalid container configuration",
+		remediation: "A secret or config map referenced by the pod template does not exist, or the container's security settings cannot be applied.",
+	},
+	{
+		target:      k8s.ErrOOMKilled,
+		title:       "Container ran out of memory",
+		remediation: "Raise the container's memory limit with --memory in `options:` or in the pod template.",
+	},
+	{
+		target:      k8s.ErrUnschedulable,
+		title:       "Pod cannot be scheduled",
+		remediation: "The runner's node cannot fit the job pod. Lower the resource requests of the job and its services, or give the runner a larger node.",
+	},
+	{
+		target:      k8s.ErrInitContainer,
+		title:       "Init container failed",
+		remediation: "Check the init containers added by the pod template; their state is listed below.",
+	},
+	{
+		target:      k8s.ErrPodStartup,
+		title:       "Pod failed to start",
+		remediation: "Check that the image name is correct, that the registry credentials can pull it and that the container does not exit on startup.",
+	},
+	{
+		target:      k8s.ErrExec,
+		title:       "Lost connection to pod",
+		remediation: "The step could not be started or its output stream broke. This is a cluster problem, not a failure of the step: check that the pod was not evicted, deleted or killed for exceeding its memory limit.",
+	},
+	{
+		target:      k8s.ErrPodNotDeleted,
+		title:       "Pod could not be deleted",
+		remediation: "The pod is still terminating after a force delete. Check for finalizers on the pod and that its node is healthy, or run `actions-k8shook gc` later.",
+	},
+	{
+		target:      k8s.ErrUnsupportedOption,
+		title:       "Unsupported container option",
+		remediation: "Remove the option from `options:` in the workflow. The supported flags, and the containers each of them applies to, are listed under \"Container options\" in the hook's README.",
+	},
+	{
+		target:      k8s.ErrInvalidOption,
+		title:       "Invalid container option",
+		remediation: "Fix the value of the option in `options:` in the workflow.",
+	},
+	{
+		target:      k8s.ErrUnsupportedVolume,
+		title:       "Unsupported container volume",
+		remediation: "Container volumes must be paths inside the runner work directory, anonymous volumes, or named volumes defined under `volumes` in the pod template.",
+	},
+	{
+		target:      k8s.ErrNotSupported,
+		title:       "Unsupported workflow feature",
+		remediation: "The Kubernetes container hook does not support this feature. Remove it from the workflow or run the job on a non-Kubernetes runner.",
+	},
+	{
+		target:      validation.ErrEmptyImage,
+		title:       "Invalid service configuration",
+		remediation: "Set `image` for every entry under `services:` in the workflow.",
+	},
+	{
+		target:      validation.ErrReservedServiceName,
+		title:       "Invalid service configuration",
+		remediation: "Rename the service; `job` is used by the job container.",
+	},
+	{
+		target:      validation.ErrInvalidServiceName,
+		title:       "Invalid service configuration",
+		remediation: "Service names become container names and must be lowercase alphanumeric or '-', at most 63 characters.",
+	},
+	{
+		target:      validation.ErrDuplicateServiceName,
+		title:       "Invalid service configuration",
+		remediation: "Give every service a unique name.",
+	},
+	{
+		target:      k8s.ErrValidation,
+		title:       "Invalid step input",
+		remediation: "Check the environment variable names passed to the step.",
+	},
+	{
+		target:      config.ErrInvalidConfig,
+		title:       "Invalid hook configuration",
+		remediation: "Fix the runner's hook configuration file or environment variables.",
+	},
+}
+
+// Error writes err as an error annotation with a remediation hint, followed by
+// a collapsed group with its details if it has any.
+func Error(w io.Writer, err error) {
+	title, remediation := defaultTitle, ""
+	for _, h := range hints {
+		if errors.Is(err, h.target) {
+			title, remediation = h.title, h.remediation
+			break
+		}
+	}
+
+	message := err.Error()
+	if remediation != "" {
+		message += "\n\nHint: " + remediation
+	}
+	fmt.Fprintf(w, "::error title=%s::%s\n", escapeProperty(title), escapeData(message))
+
+	var detailer Detailer
+	if errors.As(err, &detailer) {
+		if details := detailer.Details(); details != "" {
+			Group(w, "Details: "+title, details)
+		}
+	}
+}
+
+// Group writes body inside a collapsible group in the job log.
+func Group(w io.Writer, title, body string) {
+	fmt.Fprintf(w, "::group::%s\n", escapeData(title))
+	fmt.Fprint(w, body)
+	if !strings.HasSuffix(body, "\n") {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "::endgroup::")
+}
+
+// escapeData escapes a workflow command message.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a workflow command property value.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/validation"
+)
+
+type detailedError struct {
+	error
+	details string
+}
+
+func (e detailedError) Details() string { return e.details }
+
+func (e detailedError) Unwrap() error { return e.error }
+
+func TestError(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		err          error
+		wantPrefix   string
+		wantContains []string
+	}{
+		"pod startup": {
+			err:          fmt.Errorf("%w: failed to pull image: unauthorized for ghcr.io/foo", k8s.ErrPodStartup),
+			wantPrefix:   "::error title=Pod failed to start::pod failed to start: failed to pull image: unauthorized for ghcr.io/foo%0A%0AHint: ",
+			wantContains: []string{"registry credentials"},
+		},
+		"typed pod startup": {
+			err:          &k8s.ContainerStartupError{Err: k8s.ErrImagePull, Container: "redis", Reason: "ImagePullBackOff"},
+			wantPrefix:   "::error title=Image could not be pulled::pod failed to start: image could not be pulled: service redis: ImagePullBackOff%0A%0AHint: ",
+			wantContains: []string{"registry credentials"},
+		},
+		"missing shell": {
+			err:          fmt.Errorf("%w job-pod: %w: exec: \"sh\": executable file not found", k8s.ErrExec, k8s.ErrMissingShell),
+			wantPrefix:   "::error title=Job image has no shell::",
+			wantContains: []string{"shellHelperImage"},
+		},
+		"timeout": {
+			err:          fmt.Errorf("timeout waiting for 10 seconds: %w", k8s.ErrPodTimeout),
+			wantPrefix:   "::error title=Timed out waiting for pod::",
+			wantContains: []string{"prepareJobTimeoutSeconds"},
+		},
+		"not supported": {
+			err:        fmt.Errorf("%w: CreateOptions provided: --cpus 2", k8s.ErrNotSupported),
+			wantPrefix: "::error title=Unsupported workflow feature::",
+		},
+		"validation": {
+			err:          fmt.Errorf("service[0]: %w: 'job'", validation.ErrReservedServiceName),
+			wantPrefix:   "::error title=Invalid service configuration::",
+			wantContains: []string{"Rename the service"},
+		},
+		"unknown error": {
+			err:        errors.New("100% broken,\nreally"),
+			wantPrefix: "::error title=Container hook failed::100%25 broken,%0Areally\n",
+		},
+		"details are grouped": {
+			err: detailedError{
+				error:   fmt.Errorf("%w: pod failed", k8s.ErrPodStartup),
+				details: "Warning FailedScheduling 0/3 nodes are available",
+			},
+			wantPrefix:   "::error title=Pod failed to start::",
+			wantContains: []string{"\n::group::Details: Pod failed to start\nWarning FailedScheduling 0/3 nodes are available\n::endgroup::\n"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			Error(&out, tt.err)
+			got := out.String()
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("Error() = %q, want prefix %q", got, tt.wantPrefix)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(got, want) {
+					t.Errorf("Error() = %q, want it to contain %q", got, want)
+				}
+			}
+			if strings.Count(strings.SplitN(got, "\n", 2)[0], "::") != 2 {
+				t.Errorf("Error() annotation line is not a single workflow command: %q", got)
+			}
+		})
+	}
+}
+
+func TestEscapeProperty(t *testing.T) {
+	t.Parallel()
+	if got, want := escapeProperty("a:b,c%\n"), "a%3Ab%2Cc%25%0A"; got != want {
+		t.Errorf("escapeProperty() = %q, want %q", got, want)
+	}
+}
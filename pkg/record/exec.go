@@ -0,0 +1,72 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+)
+
+// ExecRecord is a recorded exec into a pod and its result.
+type ExecRecord struct {
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Command   []string `json:"command"`
+	Stdout    string   `json:"stdout,omitempty"`
+	Stderr    string   `json:"stderr,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	ExitCode  int      `json:"exitCode,omitempty"`
+}
+
+// WrapExec records every exec made through next.
+func (r *Recorder) WrapExec(next k8s.ExecFunc) k8s.ExecFunc {
+	return func(ctx context.Context, pod, container string, command []string, opt remotecommand.StreamOptions) error {
+		seq := r.nextExecSeq()
+		var stdout, stderr bytes.Buffer
+		if opt.Stdout != nil {
+			opt.Stdout = io.MultiWriter(opt.Stdout, &stdout)
+		}
+		if opt.Stderr != nil {
+			opt.Stderr = io.MultiWriter(opt.Stderr, &stderr)
+		}
+
+		err := next(ctx, pod, container, command, opt)
+
+		record := ExecRecord{
+			Pod:       pod,
+			Container: container,
+			Stdout:    r.redactor.String(stdout.String()),
+			Stderr:    r.redactor.String(stderr.String()),
+		}
+		for _, arg := range command {
+			record.Command = append(record.Command, r.redactor.String(arg))
+		}
+		if err != nil {
+			record.Error = r.redactor.String(err.Error())
+			var exitErr exec.ExitError
+			if errors.As(err, &exitErr) {
+				record.ExitCode = exitErr.ExitStatus()
+			}
+		}
+		if writeErr := r.writeJSON(filepath.Join(execDir, fmt.Sprintf("%04d.json", seq)), record); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+
+		return err
+	}
+}
+
+// ClientOptions returns the options that record a client's API traffic and execs.
+func (r *Recorder) ClientOptions() []k8s.ClientOption {
+	return []k8s.ClientOption{
+		k8s.WithRESTConfig(r.ConfigureREST),
+		k8s.WithExecWrapper(r.WrapExec),
+	}
+}
@@ -0,0 +1,425 @@
+// Package record captures hook invocations to disk and replays them against a
+// fake clientset, so problems seen on production runners can be reproduced
+// locally and turned into regression tests.
+//
+// A recording is a directory containing:
+//   - input.json: the hook input read from stdin
+//   - env.json: the environment variables that affect the hook
+//   - config.json: the resolved hook configuration
+//   - api/NNNN.json: every Kubernetes API request and response, in order
+//   - exec/NNNN.json: every exec into a pod and its output
+//   - response.json: the response file written by the hook, if any
+//   - meta.json: the command and its exit code
+//
+// Credentials are masked before anything is written, so a recording can be
+// attached to an issue: registry credentials and secret environment variables
+// of the hook input wherever they appear, and the data of secrets.
+package record
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/redact"
+)
+
+const (
+	inputFile    = "input.json"
+	envFile      = "env.json"
+	configFile   = "config.json"
+	responseFile = "response.json"
+	metaFile     = "meta.json"
+	apiDir       = "api"
+	execDir      = "exec"
+)
+
+// runnerEnv lists runner-provided variables that affect the hook, in addition
+// to the configuration variables.
+var runnerEnv = []string{"GITHUB_WORKSPACE", "RUNNER_TEMP", "RUNNER_WORKSPACE"}
+
+// Meta describes a recorded invocation.
+type Meta struct {
+	Command  string    `json:"command"`
+	ExitCode int       `json:"exitCode"`
+	Time     time.Time `json:"time"`
+}
+
+// maskedData replaces the values of secret data. It is valid base64, so
+// recorded secrets still decode on replay.
+var maskedData = base64.StdEncoding.EncodeToString([]byte(redact.Mask))
+
+// Recorder writes one invocation to its own directory.
+type Recorder struct {
+	dir      string
+	redactor *redact.Redactor
+	meta     Meta
+	mu       sync.Mutex
+	apiSeq   int
+	execSeq  int
+	pending  map[*recordingBody]struct{}
+}
+
+// New creates a recording directory for command below baseDir. Everything
+// recorded is masked by redactor, which should know the hook input.
+func New(baseDir, command string, redactor *redact.Redactor) (*Recorder, error) {
+	now := time.Now().UTC()
+	dir := filepath.Join(baseDir, fmt.Sprintf("%s-%s", now.Format("20060102T150405.000000000"), command))
+	for _, d := range []string{dir, filepath.Join(dir, apiDir), filepath.Join(dir, execDir)} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Recorder{
+		dir:      dir,
+		redactor: redactor,
+		meta:     Meta{Command: command, Time: now},
+		pending:  make(map[*recordingBody]struct{}),
+	}, nil
+}
+
+// Dir returns the directory the invocation is recorded to.
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// SaveInvocation records the hook input, the relevant environment and the
+// resolved configuration.
+func (r *Recorder) SaveInvocation(input []byte, cfg *config.Config) error {
+	if err := os.WriteFile(filepath.Join(r.dir, inputFile), r.redactor.JSON(input), 0o600); err != nil {
+		return err
+	}
+
+	env := make(map[string]string)
+	for _, name := range append(config.EnvNames(), runnerEnv...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = r.redactor.String(value)
+		}
+	}
+	if err := r.writeJSON(envFile, env); err != nil {
+		return err
+	}
+
+	return r.writeJSON(configFile, cfg)
+}
+
+// Finish records the response file and exit code and flushes API responses
+// whose bodies were never fully read, such as watches still open at exit.
+func (r *Recorder) Finish(responsePath string, exitCode int) error {
+	r.mu.Lock()
+	pending := make([]*recordingBody, 0, len(r.pending))
+	for body := range r.pending {
+		pending = append(pending, body)
+	}
+	r.mu.Unlock()
+	for _, body := range pending {
+		body.finish()
+	}
+
+	var errs []error
+	if responsePath != "" {
+		response, err := os.ReadFile(responsePath) // #nosec G304 -- path is the response file given by the runner
+		switch {
+		case err == nil:
+			errs = append(errs, os.WriteFile(filepath.Join(r.dir, responseFile), r.redactor.JSON(response), 0o600))
+		case !errors.Is(err, os.ErrNotExist):
+			errs = append(errs, err)
+		}
+	}
+
+	r.meta.ExitCode = exitCode
+	errs = append(errs, r.writeJSON(metaFile, r.meta))
+	return errors.Join(errs...)
+}
+
+// ConfigureREST makes the client talk JSON, so responses can be decoded on
+// replay, and records every request through a transport wrapper.
+func (r *Recorder) ConfigureREST(restConfig *rest.Config) {
+	restConfig.ContentType = "application/json"
+	restConfig.AcceptContentTypes = "application/json"
+	restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &transport{recorder: r, next: rt}
+	})
+}
+
+func (r *Recorder) nextAPISeq() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apiSeq++
+	return r.apiSeq
+}
+
+func (r *Recorder) nextExecSeq() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.execSeq++
+	return r.execSeq
+}
+
+func (r *Recorder) writeJSON(name string, v any) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(r.dir, name), body, 0o600)
+}
+
+func (r *Recorder) writeExchange(seq int, ex *Exchange) {
+	ex.RequestBody = r.redactBody(ex, ex.RequestBody)
+	ex.ResponseBody = r.redactBody(ex, ex.ResponseBody)
+	for i, event := range ex.Events {
+		ex.Events[i] = r.redactBody(ex, event)
+	}
+	ex.URL = r.redactor.String(ex.URL)
+	ex.Error = r.redactor.String(ex.Error)
+	if err := r.writeJSON(filepath.Join(apiDir, fmt.Sprintf("%04d.json", seq)), ex); err != nil {
+		slog.Warn("Failed to record API exchange", "err", err)
+	}
+}
+
+// redactBody masks the credentials in a request or response body of ex. The
+// data of secrets is masked as a whole, since the hook writes registry
+// credentials to them in encoded form.
+func (r *Recorder) redactBody(ex *Exchange, body json.RawMessage) json.RawMessage {
+	if body == nil {
+		return nil
+	}
+	if ex.Resource == "secrets" {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err == nil {
+			maskSecretData(doc)
+			if masked, err := json.Marshal(doc); err == nil {
+				body = masked
+			}
+		}
+	}
+	return r.redactor.JSON(body)
+}
+
+// maskSecretData masks the values of data and stringData in v, which is a
+// secret, a list of secrets or a watch event.
+func maskSecretData(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			data, ok := value.(map[string]any)
+			switch {
+			case ok && key == "data":
+				for k := range data {
+					data[k] = maskedData
+				}
+			case ok && key == "stringData":
+				for k := range data {
+					data[k] = redact.Mask
+				}
+			default:
+				maskSecretData(value)
+			}
+		}
+	case []any:
+		for _, value := range v {
+			maskSecretData(value)
+		}
+	}
+}
+
+// transport records every request and response passing through it.
+type transport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Exec upgrades are recorded by the exec wrapper instead.
+	if req.Header.Get("Upgrade") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	seq := t.recorder.nextAPISeq()
+	ex := newExchange(req)
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			data, _ := io.ReadAll(body)
+			ex.RequestBody = jsonOrNil(data)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		ex.Error = err.Error()
+		t.recorder.writeExchange(seq, ex)
+		return resp, err
+	}
+
+	ex.StatusCode = resp.StatusCode
+	body := &recordingBody{ReadCloser: resp.Body, recorder: t.recorder, seq: seq, exchange: ex}
+	t.recorder.mu.Lock()
+	t.recorder.pending[body] = struct{}{}
+	t.recorder.mu.Unlock()
+	resp.Body = body
+	return resp, nil
+}
+
+// recordingBody copies a response body and records the exchange once the
+// body has been read to the end or closed.
+type recordingBody struct {
+	io.ReadCloser
+	recorder *Recorder
+	seq      int
+	exchange *Exchange
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	once     sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.buf.Write(p[:n])
+	b.mu.Unlock()
+	if errors.Is(err, io.EOF) {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.mu.Lock()
+		data := b.buf.Bytes()
+		if b.exchange.Verb == "watch" {
+			b.exchange.Events = splitJSONStream(data)
+		} else {
+			b.exchange.ResponseBody = jsonOrNil(data)
+		}
+		b.mu.Unlock()
+
+		b.recorder.mu.Lock()
+		delete(b.recorder.pending, b)
+		b.recorder.mu.Unlock()
+		b.recorder.writeExchange(b.seq, b.exchange)
+	})
+}
+
+func jsonOrNil(data []byte) json.RawMessage {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || !json.Valid(data) {
+		return nil
+	}
+	return json.RawMessage(bytes.Clone(data))
+}
+
+// splitJSONStream splits a watch stream into its events. A trailing partial
+// event, cut off when the watch was closed, is dropped.
+func splitJSONStream(data []byte) []json.RawMessage {
+	var events []json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var event json.RawMessage
+		if err := decoder.Decode(&event); err != nil {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+// Exchange is a recorded Kubernetes API request and its response.
+type Exchange struct {
+	Verb         string            `json:"verb"`
+	Resource     string            `json:"resource"`
+	Subresource  string            `json:"subresource,omitempty"`
+	Namespace    string            `json:"namespace,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	RequestBody  json.RawMessage   `json:"requestBody,omitempty"`
+	StatusCode   int               `json:"statusCode,omitempty"`
+	ResponseBody json.RawMessage   `json:"responseBody,omitempty"`
+	Events       []json.RawMessage `json:"events,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// newExchange derives the Kubernetes verb and resource from a request, using
+// the same names as client-go's testing actions.
+func newExchange(req *http.Request) *Exchange {
+	ex := &Exchange{Method: req.Method, URL: req.URL.String()}
+
+	// Paths look like /api/v1/... or /apis/<group>/<version>/...
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		parts = nil
+	}
+	watch := req.URL.Query().Get("watch") == "true"
+	if len(parts) > 0 && parts[0] == "watch" {
+		watch = true
+		parts = parts[1:]
+	}
+	if len(parts) >= 2 && parts[0] == "namespaces" && len(parts) != 2 {
+		ex.Namespace = parts[1]
+		parts = parts[2:]
+	}
+	if len(parts) > 0 {
+		ex.Resource = parts[0]
+	}
+	if len(parts) > 1 {
+		ex.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		ex.Subresource = parts[2]
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		switch {
+		case watch:
+			ex.Verb = "watch"
+		case ex.Name == "":
+			ex.Verb = "list"
+		default:
+			ex.Verb = "get"
+		}
+	case http.MethodPost:
+		ex.Verb = "create"
+	case http.MethodPut:
+		ex.Verb = "update"
+	case http.MethodPatch:
+		ex.Verb = "patch"
+	case http.MethodDelete:
+		if ex.Name == "" {
+			ex.Verb = "delete-collection"
+		} else {
+			ex.Verb = "delete"
+		}
+	default:
+		ex.Verb = strings.ToLower(req.Method)
+	}
+
+	return ex
+}
@@ -0,0 +1,319 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/redact"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+// fakeAPIServer serves just enough of the pods API for the record tests.
+func fakeAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	pod := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"runner","namespace":"ns"},"spec":{"nodeName":"node-1"}}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/ns/pods/runner", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("recorded request accepts %q, want JSON", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, pod)
+	})
+	mux.HandleFunc("/api/v1/namespaces/ns/pods/missing", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404,"message":"pods \"missing\" not found"}`)
+	})
+	mux.HandleFunc("/api/v1/namespaces/ns/pods", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"type":"ADDED","object":%s}`+"\n", pod)
+		fmt.Fprintf(w, `{"type":"DELETED","object":%s}`+"\n", pod)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+	server := fakeAPIServer(t)
+	recorder, err := New(t.TempDir(), "prepare_job", redact.New())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	cfg := config.Default()
+	cfg.Namespace = "ns"
+	if err := recorder.SaveInvocation([]byte(`{"command":"prepare_job"}`), cfg); err != nil {
+		t.Fatalf("SaveInvocation() error = %v", err)
+	}
+
+	restConfig := &rest.Config{Host: server.URL}
+	recorder.ConfigureREST(restConfig)
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatalf("NewForConfig() error = %v", err)
+	}
+	pods := clientset.CoreV1().Pods("ns")
+	if _, err := pods.Get(t.Context(), "runner", v1Meta.GetOptions{}); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, err := pods.Get(t.Context(), "missing", v1Meta.GetOptions{}); !k8sErrors.IsNotFound(err) {
+		t.Fatalf("Get() error = %v, want NotFound", err)
+	}
+	watcher, err := pods.Watch(t.Context(), v1Meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	for range watcher.ResultChan() {
+	}
+
+	execStub := func(_ context.Context, _, _ string, _ []string, opt remotecommand.StreamOptions) error {
+		fmt.Fprint(opt.Stdout, "hello\n")
+		return exec.CodeExitError{Err: errors.New("command terminated with exit code 3"), Code: 3}
+	}
+	var stdout strings.Builder
+	err = recorder.WrapExec(execStub)(t.Context(), "runner", "job", []string{"sh", "-c", "exit 3"}, remotecommand.StreamOptions{Stdout: &stdout})
+	if err == nil || stdout.String() != "hello\n" {
+		t.Fatalf("recorded exec changed behaviour: err = %v, stdout = %q", err, stdout.String())
+	}
+
+	if err := recorder.Finish("", 0); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	rec, err := Load(recorder.Dir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if rec.Meta.Command != "prepare_job" || rec.Config.Namespace != "ns" || rec.Input.Command != "prepare_job" {
+		t.Errorf("Load() = %+v, want recorded invocation", rec)
+	}
+	if len(rec.Exchanges) != 3 || len(rec.Execs) != 1 {
+		t.Fatalf("Load() found %d exchanges and %d execs, want 3 and 1", len(rec.Exchanges), len(rec.Execs))
+	}
+
+	client, err := k8s.NewK8sClient(rec.Config, rec.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("NewK8sClient() error = %v", err)
+	}
+	node, err := client.GetPodNodeName(t.Context(), "runner")
+	if err != nil || node != "node-1" {
+		t.Errorf("replayed GetPodNodeName() = %q, %v, want node-1", node, err)
+	}
+	if _, err := client.GetPodNodeName(t.Context(), "missing"); !k8sErrors.IsNotFound(err) {
+		t.Errorf("replayed GetPodNodeName() error = %v, want NotFound", err)
+	}
+	if _, err := client.GetPodNodeName(t.Context(), "runner"); !errors.Is(err, ErrNoRecordedExchange) {
+		t.Errorf("GetPodNodeName() beyond the recording error = %v, want %v", err, ErrNoRecordedExchange)
+	}
+
+	stdout.Reset()
+	opts := rec.ClientOptions()
+	client, _ = k8s.NewK8sClient(rec.Config, append(opts, k8s.WithExecWrapper(func(next k8s.ExecFunc) k8s.ExecFunc {
+		return func(ctx context.Context, pod, container string, command []string, opt remotecommand.StreamOptions) error {
+			opt.Stdout = &stdout
+			return next(ctx, pod, container, command, opt)
+		}
+	}))...)
+	err = client.ExecInPod(t.Context(), "runner", []string{"-c", "exit 3"})
+	var exitErr exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 || stdout.String() != "hello\n" {
+		t.Errorf("replayed exec = %v, stdout %q, want exit code 3 and recorded output", err, stdout.String())
+	}
+}
+
+func TestReplayWatch(t *testing.T) {
+	t.Parallel()
+	pod := v1.Pod{TypeMeta: v1Meta.TypeMeta{Kind: "Pod", APIVersion: "v1"}, ObjectMeta: v1Meta.ObjectMeta{Name: "job"}}
+	podJSON, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Failed to marshal pod: %v", err)
+	}
+	r := &replayer{exchanges: []*Exchange{{
+		Verb:     "watch",
+		Resource: "pods",
+		Events:   []json.RawMessage{json.RawMessage(fmt.Sprintf(`{"type":"MODIFIED","object":%s}`, podJSON))},
+	}}}
+	action := k8sTesting.NewWatchAction(v1.SchemeGroupVersion.WithResource("pods"), "ns", v1Meta.ListOptions{})
+
+	_, watcher, err := r.watch(action)
+	if err != nil {
+		t.Fatalf("watch() error = %v", err)
+	}
+	event := <-watcher.ResultChan()
+	got, ok := event.Object.(*v1.Pod)
+	if event.Type != watch.Modified || !ok || got.Name != "job" {
+		t.Errorf("watch() event = %v %v, want recorded MODIFIED pod", event.Type, event.Object)
+	}
+
+	// Once the recording is used up, watches stay idle instead of failing.
+	_, watcher, err = r.watch(action)
+	if err != nil || watcher == nil {
+		t.Errorf("watch() beyond the recording = %v, %v, want idle watcher", watcher, err)
+	}
+}
+
+func TestNewExchange(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		method string
+		url    string
+		want   Exchange
+	}{
+		"get pod": {
+			method: http.MethodGet,
+			url:    "https://k8s/api/v1/namespaces/ns/pods/job",
+			want:   Exchange{Verb: "get", Resource: "pods", Namespace: "ns", Name: "job"},
+		},
+		"list secrets": {
+			method: http.MethodGet,
+			url:    "https://k8s/api/v1/namespaces/ns/secrets?labelSelector=runner-pod%3Dr",
+			want:   Exchange{Verb: "list", Resource: "secrets", Namespace: "ns"},
+		},
+		"watch pods": {
+			method: http.MethodGet,
+			url:    "https://k8s/api/v1/namespaces/ns/pods?watch=true",
+			want:   Exchange{Verb: "watch", Resource: "pods", Namespace: "ns"},
+		},
+		"delete pod": {
+			method: http.MethodDelete,
+			url:    "https://k8s/api/v1/namespaces/ns/pods/job",
+			want:   Exchange{Verb: "delete", Resource: "pods", Namespace: "ns", Name: "job"},
+		},
+		"pod logs": {
+			method: http.MethodGet,
+			url:    "https://k8s/api/v1/namespaces/ns/pods/job/log",
+			want:   Exchange{Verb: "get", Resource: "pods", Subresource: "log", Namespace: "ns", Name: "job"},
+		},
+		"access review": {
+			method: http.MethodPost,
+			url:    "https://k8s/apis/authorization.k8s.io/v1/selfsubjectaccessreviews",
+			want:   Exchange{Verb: "create", Resource: "selfsubjectaccessreviews"},
+		},
+		"get namespace": {
+			method: http.MethodGet,
+			url:    "https://k8s/api/v1/namespaces/ns",
+			want:   Exchange{Verb: "get", Resource: "namespaces", Name: "ns"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			got := newExchange(req)
+			if got.Verb != tt.want.Verb || got.Resource != tt.want.Resource || got.Subresource != tt.want.Subresource ||
+				got.Namespace != tt.want.Namespace || got.Name != tt.want.Name {
+				t.Errorf("newExchange() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRedacts(t *testing.T) {
+	t.Parallel()
+	input := []byte(`{"command":"run_container_step","args":{"image":"ghcr.io/org/step",` +
+		`"registry":{"username":"robot","password":"hunter22"},"environmentVariables":{"API_TOKEN":"ghs_abcdef"}}}`)
+	var hookInput types.ContainerHookInput
+	if err := json.Unmarshal(input, &hookInput); err != nil {
+		t.Fatalf("Failed to parse hook input: %v", err)
+	}
+	redactor := redact.New()
+	redactor.AddInput(hookInput)
+
+	secret := `{"kind":"Secret","apiVersion":"v1","metadata":{"name":"pull","namespace":"ns"},` +
+		`"data":{".dockerconfigjson":"eyJhdXRocyI6e319"},"type":"kubernetes.io/dockerconfigjson"}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/ns/secrets", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, secret)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	recorder, err := New(t.TempDir(), "run_container_step", redactor)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := recorder.SaveInvocation(input, config.Default()); err != nil {
+		t.Fatalf("SaveInvocation() error = %v", err)
+	}
+	restConfig := &rest.Config{Host: server.URL}
+	recorder.ConfigureREST(restConfig)
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatalf("NewForConfig() error = %v", err)
+	}
+	_, err = clientset.CoreV1().Secrets("ns").Create(t.Context(), &v1.Secret{
+		ObjectMeta: v1Meta.ObjectMeta{Name: "pull"},
+		StringData: map[string]string{"password": "plain-text-password"},
+		Data:       map[string][]byte{v1.DockerConfigJsonKey: []byte(`{"auths":{"ghcr.io":{"auth":"cm9ib3Q6aHVudGVyMjI="}}}`)},
+	}, v1Meta.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	execStub := func(_ context.Context, _, _ string, _ []string, opt remotecommand.StreamOptions) error {
+		fmt.Fprint(opt.Stdout, "logged in as robot\n")
+		return nil
+	}
+	if err := recorder.WrapExec(execStub)(t.Context(), "job", "job", []string{"login", "-p", "hunter22"}, remotecommand.StreamOptions{Stdout: io.Discard}); err != nil {
+		t.Fatalf("recorded exec error = %v", err)
+	}
+	if err := recorder.Finish("", 0); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	err = filepath.WalkDir(recorder.Dir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, leaked := range []string{"hunter22", "robot", "ghs_abcdef", "plain-text-password", "eyJhdXRocyI6e319"} {
+			if strings.Contains(string(data), leaked) {
+				t.Errorf("recorded %s contains %q:\n%s", filepath.Base(path), leaked, data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+
+	// The masked recording still replays.
+	rec, err := Load(recorder.Dir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	r := &replayer{exchanges: rec.Exchanges, execs: rec.Execs}
+	_, obj, err := r.react(k8sTesting.NewCreateAction(v1.SchemeGroupVersion.WithResource("secrets"), "ns", &v1.Secret{}))
+	if got, ok := obj.(*v1.Secret); err != nil || !ok || string(got.Data[v1.DockerConfigJsonKey]) != redact.Mask {
+		t.Errorf("replayed secret = %v, %v, want masked data", obj, err)
+	}
+}
@@ -0,0 +1,214 @@
+package record
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1Meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/reMarkable/k8s-hook/pkg/config"
+	"github.com/reMarkable/k8s-hook/pkg/k8s"
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+var (
+	ErrNoRecordedExchange = errors.New("no recorded API response")
+	ErrNoRecordedExec     = errors.New("no recorded exec")
+)
+
+// Recording is an invocation loaded from disk.
+type Recording struct {
+	Dir       string
+	Meta      Meta
+	Input     types.ContainerHookInput
+	Env       map[string]string
+	Config    *config.Config
+	Response  json.RawMessage
+	Exchanges []*Exchange
+	Execs     []*ExecRecord
+}
+
+// Load reads a recording directory written by a Recorder.
+func Load(dir string) (*Recording, error) {
+	rec := &Recording{Dir: dir, Config: config.Default()}
+	for name, v := range map[string]any{
+		metaFile:   &rec.Meta,
+		inputFile:  &rec.Input,
+		envFile:    &rec.Env,
+		configFile: rec.Config,
+	} {
+		if err := readJSON(filepath.Join(dir, name), v); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := os.ReadFile(filepath.Join(dir, responseFile)) // #nosec G304 -- recording directory is chosen by the user running replay
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	rec.Response = response
+
+	if rec.Exchanges, err = readJSONDir[Exchange](filepath.Join(dir, apiDir)); err != nil {
+		return nil, err
+	}
+	if rec.Execs, err = readJSONDir[ExecRecord](filepath.Join(dir, execDir)); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// ClientOptions returns options that serve the recorded API responses and
+// exec results from a fake clientset, in the order they were recorded.
+func (rec *Recording) ClientOptions() []k8s.ClientOption {
+	r := &replayer{exchanges: rec.Exchanges, execs: rec.Execs}
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("*", "*", r.react)
+	clientset.PrependWatchReactor("*", r.watch)
+
+	return []k8s.ClientOption{
+		k8s.WithClientset(clientset),
+		k8s.WithExec(r.exec),
+	}
+}
+
+type replayer struct {
+	mu        sync.Mutex
+	exchanges []*Exchange
+	execs     []*ExecRecord
+}
+
+// next removes and returns the first unused exchange matching the action.
+func (r *replayer) next(action k8sTesting.Action) (*Exchange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, ex := range r.exchanges {
+		if ex.Verb == action.GetVerb() && ex.Resource == action.GetResource().Resource && ex.Subresource == action.GetSubresource() {
+			r.exchanges = append(r.exchanges[:i], r.exchanges[i+1:]...)
+			return ex, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for %s %s", ErrNoRecordedExchange, action.GetVerb(), action.GetResource().Resource)
+}
+
+func (r *replayer) react(action k8sTesting.Action) (bool, runtime.Object, error) {
+	ex, err := r.next(action)
+	if err != nil {
+		return true, nil, err
+	}
+	if ex.Error != "" {
+		return true, nil, errors.New(ex.Error)
+	}
+	if len(ex.ResponseBody) == 0 {
+		return true, nil, nil
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(ex.ResponseBody, nil, nil)
+	if err != nil {
+		return true, nil, fmt.Errorf("decoding recorded %s %s response: %w", ex.Verb, ex.Resource, err)
+	}
+	if status, ok := obj.(*v1Meta.Status); ok && status.Status == v1Meta.StatusFailure {
+		return true, nil, &k8sErrors.StatusError{ErrStatus: *status}
+	}
+
+	return true, obj, nil
+}
+
+func (r *replayer) watch(action k8sTesting.Action) (bool, watch.Interface, error) {
+	ex, err := r.next(action)
+	if err != nil {
+		// Behave like a watch that never sees a change.
+		return true, watch.NewFake(), nil
+	}
+	if ex.Error != "" {
+		return true, nil, errors.New(ex.Error)
+	}
+
+	watcher := watch.NewFakeWithChanSize(len(ex.Events), false)
+	for _, raw := range ex.Events {
+		var event v1Meta.WatchEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return true, nil, fmt.Errorf("decoding recorded watch event: %w", err)
+		}
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(event.Object.Raw, nil, nil)
+		if err != nil {
+			return true, nil, fmt.Errorf("decoding recorded watch object: %w", err)
+		}
+		watcher.Action(watch.EventType(event.Type), obj)
+	}
+
+	return true, watcher, nil
+}
+
+func (r *replayer) exec(_ context.Context, pod, container string, command []string, opt remotecommand.StreamOptions) error {
+	r.mu.Lock()
+	if len(r.execs) == 0 {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s/%s %v", ErrNoRecordedExec, pod, container, command)
+	}
+	record := r.execs[0]
+	r.execs = r.execs[1:]
+	r.mu.Unlock()
+
+	if opt.Stdout != nil {
+		_, _ = opt.Stdout.Write([]byte(record.Stdout))
+	}
+	if opt.Stderr != nil {
+		_, _ = opt.Stderr.Write([]byte(record.Stderr))
+	}
+	switch {
+	case record.ExitCode != 0:
+		return exec.CodeExitError{Err: errors.New(record.Error), Code: record.ExitCode}
+	case record.Error != "":
+		return errors.New(record.Error)
+	default:
+		return nil
+	}
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- recording directory is chosen by the user running replay
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readJSONDir reads every JSON file in dir, ordered by file name.
+func readJSONDir[T any](dir string) ([]*T, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	items := make([]*T, 0, len(files))
+	for _, file := range files {
+		item := new(T)
+		if err := readJSON(file, item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
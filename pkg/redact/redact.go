@@ -0,0 +1,225 @@
+// Package redact masks credentials in debug output, so DEBUG_HOOK can be
+// enabled without leaking them into job logs.
+package redact
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+// Mask replaces every secret in redacted output.
+const Mask = "***"
+
+// minLength is the length below which values are not masked, since masking
+// them would garble unrelated output without protecting much.
+const minLength = 4
+
+// secretName matches the names of variables and fields that hold secrets.
+var secretName = regexp.MustCompile(`(?i)token|secret|passw(or)?d`)
+
+// Redactor masks the secret values it was given, and the values of secret
+// fields, in strings, JSON documents and log records. It is safe for
+// concurrent use, so values can be added after it is installed as a handler.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+func New() *Redactor {
+	return &Redactor{}
+}
+
+// Add masks values from now on.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		if len(v) >= minLength && !slices.Contains(r.values, v) {
+			r.values = append(r.values, v)
+		}
+	}
+	// Longer values go first, so a secret that contains another one is
+	// masked as a whole.
+	slices.SortFunc(r.values, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(r.values))
+	for _, v := range r.values {
+		pairs = append(pairs, v, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// AddInput masks the registry credentials of the job container, the step
+// and the services, and the values of environment variables with secret
+// names.
+func (r *Redactor) AddInput(input types.ContainerHookInput) {
+	args := input.Args
+	add := func(registry, env map[string]string) {
+		r.addRegistry(registry)
+		for name, value := range env {
+			if secretName.MatchString(name) {
+				r.Add(value)
+			}
+		}
+	}
+	add(args.Registry, args.EnvironmentVariables)
+	add(args.Container.Registry, args.Container.EnvironmentVariables)
+	for _, service := range args.Services {
+		add(service.Registry, service.EnvironmentVariables)
+	}
+}
+
+// addRegistry masks registry credentials along with the auth string they
+// are encoded to in pull secrets.
+func (r *Redactor) addRegistry(registry map[string]string) {
+	username, password := registry["username"], registry["password"]
+	if password == "" {
+		return
+	}
+	r.Add(password, username, base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// AddMaskFile masks every non-empty line of the file at path.
+func (r *Redactor) AddMaskFile(path string) error {
+	f, err := os.Open(path) // #nosec G304 -- path comes from operator-supplied configuration
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var values []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			values = append(values, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading mask file %s: %w", path, err)
+	}
+	r.Add(values...)
+
+	return nil
+}
+
+// String masks the secret values in s.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// JSON masks the values of secret fields in a JSON document, such as the
+// hook input, and then the secret values anywhere else in it. Documents that
+// do not parse are masked as strings.
+func (r *Redactor) JSON(data []byte) []byte {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []byte(r.String(string(data)))
+	}
+	masked, err := json.Marshal(r.mask("", doc))
+	if err != nil {
+		return []byte(r.String(string(data)))
+	}
+	return masked
+}
+
+func (r *Redactor) mask(parent string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s != "" && (secretName.MatchString(key) || parent == "registry" && key == "username") {
+				v[key] = Mask
+				continue
+			}
+			v[key] = r.mask(key, value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = r.mask(parent, value)
+		}
+		return v
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+// Handler returns a slog handler that masks secrets in the message and the
+// attributes of records before passing them on to next.
+func (r *Redactor) Handler(next slog.Handler) slog.Handler {
+	return &handler{next: next, r: r}
+}
+
+type handler struct {
+	next slog.Handler
+	r    *Redactor
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	masked := slog.NewRecord(record.Time, record.Level, h.r.String(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, masked)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		masked = append(masked, h.attr(a))
+	}
+	return &handler{next: h.next.WithAttrs(masked), r: h.r}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), r: h.r}
+}
+
+func (h *handler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		if secretName.MatchString(a.Key) && v.String() != "" {
+			return slog.String(a.Key, Mask)
+		}
+		return slog.String(a.Key, h.r.String(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		masked := make([]any, 0, len(attrs))
+		for _, ga := range attrs {
+			masked = append(masked, h.attr(ga))
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindAny:
+		if secretName.MatchString(a.Key) {
+			return slog.String(a.Key, Mask)
+		}
+		// Formatted like the text handler would, so secrets in errors and
+		// structs are masked too.
+		return slog.String(a.Key, h.r.String(fmt.Sprintf("%+v", v.Any())))
+	default:
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
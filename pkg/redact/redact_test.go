@@ -0,0 +1,95 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reMarkable/k8s-hook/pkg/types"
+)
+
+const hookInput = `{
+  "command": "run_container_step",
+  "args": {
+    "image": "ghcr.io/org/step:1",
+    "registry": {"username": "robot", "password": "hunter22", "serverUrl": "ghcr.io"},
+    "environmentVariables": {"INPUT_TOKEN": "ghs_abcdef", "DB_PASSWORD": "pa55word", "GREETING": "hello"},
+    "entryPointArgs": ["--token", "ghs_abcdef", "--masked", "from-mask-file"],
+    "services": [
+      {"image": "postgres", "environmentVariables": {"POSTGRES_PASSWORD": "s3rvice"}}
+    ]
+  }
+}`
+
+func newRedactor(t *testing.T) *Redactor {
+	t.Helper()
+	var input types.ContainerHookInput
+	if err := json.Unmarshal([]byte(hookInput), &input); err != nil {
+		t.Fatalf("Failed to parse hook input: %v", err)
+	}
+	maskFile := filepath.Join(t.TempDir(), "mask")
+	if err := os.WriteFile(maskFile, []byte("from-mask-file\n\n  \nabc\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write mask file: %v", err)
+	}
+
+	r := New()
+	r.AddInput(input)
+	if err := r.AddMaskFile(maskFile); err != nil {
+		t.Fatalf("AddMaskFile() unexpected error = %v", err)
+	}
+	return r
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+	r := newRedactor(t)
+
+	got := string(r.JSON([]byte(hookInput)))
+	for _, secret := range []string{"hunter22", "robot", "ghs_abcdef", "pa55word", "s3rvice", "from-mask-file"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("JSON() output contains %q:\n%s", secret, got)
+		}
+	}
+	for _, keep := range []string{"ghcr.io/org/step:1", `"serverUrl":"ghcr.io"`, `"GREETING":"hello"`, "--token"} {
+		if !strings.Contains(got, keep) {
+			t.Errorf("JSON() output lost %q:\n%s", keep, got)
+		}
+	}
+
+	if got := string(r.JSON([]byte(`{"broken": "hunter22`))); got != `{"broken": "***` {
+		t.Errorf("JSON() of invalid document = %q, want secrets masked as string", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	r := newRedactor(t)
+	var out bytes.Buffer
+	log := slog.New(r.Handler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	log.With("registry", "robot").Debug("logging in with hunter22",
+		"command", []string{"login", "-p", "hunter22"},
+		"err", fmt.Errorf("bad credentials %s", "cm9ib3Q6aHVudGVyMjI="),
+		"password", "not-in-input",
+		slog.Group("step", "env", "INPUT_TOKEN=ghs_abcdef"),
+		"short", "abc",
+		"code", 3,
+	)
+
+	got := out.String()
+	for _, secret := range []string{"hunter22", "robot", "cm9ib3Q6aHVudGVyMjI=", "not-in-input", "ghs_abcdef"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("log output contains %q:\n%s", secret, got)
+		}
+	}
+	for _, keep := range []string{"short=abc", "code=3", `step.env="INPUT_TOKEN=***"`} {
+		if !strings.Contains(got, keep) {
+			t.Errorf("log output lost %q:\n%s", keep, got)
+		}
+	}
+}
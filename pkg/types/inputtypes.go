@@ -4,6 +4,7 @@ package types
 import (
 	"encoding/json"
 	"slices"
+	"time"
 )
 
 type ContainerHookInput struct {
@@ -110,6 +111,18 @@ type ServiceDefinition struct {
 	SystemMountVolumes   []MountVolume     `json:"systemMountVolumes"`
 	UserMountVolumes     []MountVolume     `json:"userMountVolumes"`
 	CreateOptions        string            `json:"createOptions"`
+	// Healthcheck is the image's HEALTHCHECK, if the hook inspected the image.
+	Healthcheck *Healthcheck `json:"-"`
+}
+
+// Healthcheck is a docker health check. Zero values mean docker's defaults.
+type Healthcheck struct {
+	// Test is ["CMD", args...], ["CMD-SHELL", command] or ["NONE"].
+	Test        []string
+	Interval    time.Duration
+	Timeout     time.Duration
+	StartPeriod time.Duration
+	Retries     int
 }
 
 type MountVolume struct {